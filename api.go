@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/argot42/DomesticAdvisor/exporter"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// commands sent over http are a single line
+const maxBody = 64 << 10
+
+// listenHTTP serves the api on the http address of the configuration,
+// closing the server that was running before
+func (d *daemon) listenHTTP() error {
+	l, err := openHTTP(d.cfg.HTTPAddr)
+	if err != nil {
+		return err
+	}
+
+	d.serveHTTP(l)
+	return nil
+}
+
+// openHTTP listens on the address, there is no listener if it's empty
+func openHTTP(addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("http: %s", err)
+	}
+
+	return l, nil
+}
+
+// serveHTTP closes the server that was running and serves the api on l
+func (d *daemon) serveHTTP(l net.Listener) {
+	if d.http != nil {
+		d.http.Close()
+		d.http = nil
+	}
+
+	if l == nil {
+		return
+	}
+
+	srv := &http.Server{Handler: d.api()}
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			log.Printf("http: %s\n", err)
+		}
+	}()
+
+	d.http = srv
+	log.Println("serving http on", l.Addr())
+}
+
+/*
+* GET   /stats          [?period=<yyyy|yyyy-qN|yyyy-mm> | ?from=<date>&to=<date>]
+* GET   /transactions   [?name=<pattern>&from=<date>&to=<date>&min=<amount>&max=<amount>]
+* GET   /events         [same filters as transactions]
+* GET   /calendar.ics   events as an iCalendar
+* GET   /forecast       [?months=<n>&by=<day|month>]
+* POST  /transactions   tr command
+* POST  /events         ev command
+* POST  /ctl            any command but q, st and fc
+ */
+func (d *daemon) api() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only GET"))
+			return
+		}
+
+		// the status file unless a period is asked for
+		if len(r.URL.Query()) == 0 {
+			reply(w, http.StatusOK, d.ledger.Stats())
+			return
+		}
+
+		q, err := httpStatsQuery(r)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		reply(w, http.StatusOK, d.ledger.Period(q.Period))
+	})
+
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			q, err := httpQuery(r, "tr")
+			if err != nil {
+				httpError(w, http.StatusBadRequest, err)
+				return
+			}
+			reply(w, http.StatusOK, d.ledger.Query(q).Transactions)
+		case http.MethodPost:
+			d.post(w, r, "tr")
+		default:
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only GET and POST"))
+		}
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			q, err := httpQuery(r, "ev")
+			if err != nil {
+				httpError(w, http.StatusBadRequest, err)
+				return
+			}
+			reply(w, http.StatusOK, d.ledger.Query(q).Events)
+		case http.MethodPost:
+			d.post(w, r, "ev")
+		default:
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only GET and POST"))
+		}
+	})
+
+	mux.HandleFunc("/forecast", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only GET"))
+			return
+		}
+
+		q, err := httpForecastQuery(r)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		reply(w, http.StatusOK, d.ledger.Forecast(q))
+	})
+
+	mux.HandleFunc("/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only GET"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		exporter.ICS(w, d.ledger.Events(), d.clock.Now())
+	})
+
+	mux.HandleFunc("/ctl", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httpError(w, http.StatusMethodNotAllowed, errors.New("only POST"))
+			return
+		}
+
+		d.post(w, r, "")
+	})
+
+	return mux
+}
+
+// post runs the command in the body of the request, cmd is the only
+// command accepted if not empty. The transaction or event the command
+// touched is sent back.
+func (d *daemon) post(w http.ResponseWriter, r *http.Request, cmd string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	parsed, err := stats.Parse(bytes.NewReader(body))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("parsing: %s", err))
+		return
+	}
+	if cmd != "" && parsed[0] != cmd {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("%s is not a %s command", parsed[0], cmd))
+		return
+	}
+	if err = remoteCommand(parsed); err != nil {
+		httpError(w, http.StatusForbidden, err)
+		return
+	}
+
+	res, err := d.submit(parsed)
+	if err == errStopped {
+		httpError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	status := http.StatusOK
+	if parsed[0] == "tr" || parsed[0] == "ev" {
+		status = http.StatusCreated
+	}
+
+	switch res.Kind {
+	case "tr":
+		if tr, ok := d.ledger.Transaction(res.Id); ok {
+			reply(w, status, tr)
+			return
+		}
+	case "ev":
+		if ev, ok := d.ledger.Event(res.Id); ok {
+			reply(w, status, ev)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpQuery takes the filters of a q command from the url, writing to
+// files is left to the control file
+func httpQuery(r *http.Request, kind string) (stats.Query, error) {
+	args := []string{"q", "type=" + kind}
+
+	for key, values := range r.URL.Query() {
+		switch key {
+		case "name", "from", "to", "min", "max":
+		default:
+			return stats.Query{}, fmt.Errorf("%s is not a filter", key)
+		}
+
+		for _, value := range values {
+			args = append(args, key+"="+value)
+		}
+	}
+
+	return stats.ProcessQuery(args)
+}
+
+// httpStatsQuery takes the period of a st command from the url
+func httpStatsQuery(r *http.Request) (stats.StatsQuery, error) {
+	args := []string{"st"}
+
+	for key, values := range r.URL.Query() {
+		switch key {
+		case "period", "from", "to":
+		default:
+			return stats.StatsQuery{}, fmt.Errorf("%s is not an option", key)
+		}
+
+		for _, value := range values {
+			args = append(args, key+"="+value)
+		}
+	}
+
+	return stats.ProcessStatsQuery(args)
+}
+
+// httpForecastQuery takes the options of a fc command from the url
+func httpForecastQuery(r *http.Request) (stats.ForecastQuery, error) {
+	args := []string{"fc"}
+
+	for key, values := range r.URL.Query() {
+		switch key {
+		case "months", "by":
+		default:
+			return stats.ForecastQuery{}, fmt.Errorf("%s is not an option", key)
+		}
+
+		for _, value := range values {
+			args = append(args, key+"="+value)
+		}
+	}
+
+	return stats.ProcessForecastQuery(args)
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("http: %s\n", err)
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	reply(w, status, struct {
+		Error string
+	}{err.Error()})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+func TestAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	srv := httptest.NewServer(d.api())
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	cases := []struct {
+		Method string
+		Path   string
+		Body   string
+		Status int
+	}{
+		{"POST", "/transactions", "tr market food 2020-01-10 -30", http.StatusCreated},
+		{"POST", "/events", "ev rent flat 2020-02-01 -1 0,1,0 -500", http.StatusCreated},
+		{"POST", "/ctl", "tr payroll \"\" 2020-01-01 1000", http.StatusCreated},
+		{"POST", "/ctl", "pause ev 0", http.StatusOK},
+		{"POST", "/transactions", "ev rent flat 2020-02-01 1 0,0,0 -500", http.StatusBadRequest},
+		{"POST", "/transactions", "tr foo bar 2020-13-01 200", http.StatusBadRequest},
+		{"GET", "/ctl", "", http.StatusMethodNotAllowed},
+		{"DELETE", "/transactions", "", http.StatusMethodNotAllowed},
+		{"GET", "/transactions?type=ev", "", http.StatusBadRequest},
+		{"GET", "/stats?period=2020-13", "", http.StatusBadRequest},
+		{"GET", "/forecast?months=0", "", http.StatusBadRequest},
+		// nothing sent over http writes files
+		{"POST", "/ctl", "q out=/etc/passwd", http.StatusForbidden},
+		{"POST", "/ctl", "st period=2020", http.StatusForbidden},
+		{"POST", "/ctl", "fc", http.StatusForbidden},
+		{"POST", "/ctl", "tr foo bar 2020-01-01 1 out=../x", http.StatusForbidden},
+	}
+	for i, c := range cases {
+		if res := do(c.Method, c.Path, c.Body); res.StatusCode != c.Status {
+			b, _ := ioutil.ReadAll(res.Body)
+			t.Errorf("%d: got %d and should be %d: %s", i, res.StatusCode, c.Status, b)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "x")); err == nil {
+		t.Errorf("out= wrote a file")
+	}
+
+	var trs []stats.Transaction
+	if err = json.NewDecoder(do("GET", "/transactions?min=0", "").Body).Decode(&trs); err != nil {
+		t.Fatal(err)
+	}
+	if len(trs) != 1 || trs[0].Name != "payroll" {
+		t.Errorf("got %+v", trs)
+	}
+
+	var evs []stats.Event
+	if err = json.NewDecoder(do("GET", "/events", "").Body).Decode(&evs); err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 1 || evs[0].State != stats.Paused || evs[0].Step != [3]int{0, 1, 0} {
+		t.Errorf("got %+v", evs)
+	}
+
+	var s stats.Stats
+	if err = json.NewDecoder(do("GET", "/stats", "").Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Treasury.Total != amount("970") {
+		t.Errorf("treasury is %s", s.Treasury.Total)
+	}
+
+	if res := do("POST", "/ctl", "resume ev 0"); res.StatusCode != http.StatusOK {
+		t.Errorf("resume got %d", res.StatusCode)
+	}
+	res := do("GET", "/calendar.ics", "")
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("content type is %q", ct)
+	}
+	// the calendar is stamped by the clock of the daemon
+	if b, _ := ioutil.ReadAll(res.Body); !strings.Contains(string(b), "DTSTAMP:20200115T000000Z\r\n") || !strings.Contains(string(b), "RRULE:FREQ=MONTHLY;INTERVAL=1\r\n") {
+		t.Errorf("got\n%s", b)
+	}
+}
+
+// amount parses a literal amount for test cases
+func amount(s string) stats.Amount {
+	a, err := stats.ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
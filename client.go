@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+var errNoDaemon = errors.New("neither socket nor http are set in the configuration")
+
+// client reaches the daemon through the socket or the http api, whichever
+// the configuration has
+type client struct {
+	cfg  *config.Config
+	http *http.Client
+}
+
+/*
+* add   tr <name> <description> <date> <amount> [options]
+* add   ev <name> <description> <date> <times> <step> <amount> [options]
+* rm    <tr|ev> <id>
+* list  [tr|ev] [<filter>=<value>]...
+* stats [period=<yyyy|yyyy-qN|yyyy-mm>] [from=<date> to=<date>]
+* forecast [months=<n>] [by=<day|month>]
+* import csv <profile> <file>
+* import ofx <file> [acc=<account>] [cat=<category>]
+* import ledger <file>
+* export ledger|ics
+ */
+func runClient(cfg *config.Config, args []string) error {
+	c := &client{cfg, &http.Client{Timeout: cfg.Timeout}}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("add: missing tr or ev")
+		}
+
+		// nothing is sent that the daemon would reject anyway
+		var err error
+		switch args[1] {
+		case "tr":
+			_, err = stats.ProcessTransaction(args[1:])
+		case "ev":
+			_, err = stats.ProcessEvent(args[1:])
+		default:
+			err = fmt.Errorf("add: %q should be tr or ev", args[1])
+		}
+		if err != nil {
+			return err
+		}
+
+		id, err := c.send(args[1:])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("added %s %d\n", args[1], id)
+	case "rm":
+		if _, _, err := stats.ProcessTarget(args); err != nil {
+			return err
+		}
+
+		if _, err := c.send(args); err != nil {
+			return err
+		}
+
+		fmt.Printf("removed %s %s\n", args[1], args[2])
+	case "list":
+		return c.list(args[1:])
+	case "stats":
+		return c.stats(args[1:])
+	case "forecast":
+		return c.forecast(args[1:])
+	case "import":
+		return c.importFile(args[1:])
+	case "export":
+		return c.exportFile(args[1:])
+	default:
+		return fmt.Errorf("%s is not a command", args[0])
+	}
+
+	return nil
+}
+
+// send runs the command on the daemon and returns the id of what it touched
+func (c *client) send(record []string) (uint, error) {
+	var line bytes.Buffer
+	w := csv.NewWriter(&line)
+	w.Comma = ' '
+	w.Write(record)
+	w.Flush()
+
+	switch {
+	case c.cfg.SocketPath != "":
+		return c.sendSocket(line.Bytes())
+	case c.cfg.HTTPAddr != "":
+		return c.sendHTTP(line.Bytes())
+	}
+
+	return 0, errNoDaemon
+}
+
+func (c *client) sendSocket(line []byte) (uint, error) {
+	conn, err := net.DialTimeout("unix", c.cfg.SocketPath, c.cfg.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+
+	if _, err = conn.Write(line); err != nil {
+		return 0, err
+	}
+
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	answer = strings.TrimSuffix(answer, "\n")
+
+	switch {
+	case answer == "ok":
+		return 0, nil
+	case strings.HasPrefix(answer, "ok "):
+		id, err := strconv.ParseUint(answer[3:], 10, 0)
+		return uint(id), err
+	case strings.HasPrefix(answer, "err "):
+		return 0, errors.New(answer[4:])
+	}
+
+	return 0, fmt.Errorf("unexpected answer %q", answer)
+}
+
+func (c *client) sendHTTP(line []byte) (uint, error) {
+	resp, err := c.http.Post("http://"+c.cfg.HTTPAddr+"/ctl", "text/plain", bytes.NewReader(line))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return 0, nil
+	}
+
+	// both entries and errors are objects
+	var answer struct {
+		Id    uint
+		Error string
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return 0, err
+	}
+	if answer.Error != "" {
+		return 0, errors.New(answer.Error)
+	}
+
+	return answer.Id, nil
+}
+
+func (c *client) get(path string, v interface{}) error {
+	if c.cfg.HTTPAddr == "" {
+		return fmt.Errorf("http is not set in the configuration")
+	}
+
+	resp, err := c.http.Get("http://" + c.cfg.HTTPAddr + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string
+		}
+		json.NewDecoder(resp.Body).Decode(&answer)
+		return fmt.Errorf("%s: %s", resp.Status, answer.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *client) list(args []string) error {
+	kinds := []string{"tr", "ev"}
+	if len(args) > 0 && (args[0] == "tr" || args[0] == "ev") {
+		kinds = args[:1]
+		args = args[1:]
+	}
+
+	// filters are checked here so mistakes don't need the daemon
+	if _, err := stats.ProcessQuery(append([]string{"q"}, args...)); err != nil {
+		return err
+	}
+
+	filters := url.Values{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		filters.Add(kv[0], kv[1])
+	}
+	query := ""
+	if len(filters) > 0 {
+		query = "?" + filters.Encode()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	for i, kind := range kinds {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		if kind == "tr" {
+			var transactions []stats.Transaction
+			if err := c.get("/transactions"+query, &transactions); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(w, "ID\tDATE\tNAME\tDESCRIPTION\tAMOUNT\tCURRENCY\tACCOUNT\tCATEGORY")
+			for _, tr := range transactions {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tr.Id, tr.Date.Format("2006-01-02"), tr.Name, tr.Description, tr.Amount, tr.Currency, tr.Account, tr.Category)
+			}
+			continue
+		}
+
+		var events []stats.Event
+		if err := c.get("/events"+query, &events); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, "ID\tNEXT\tNAME\tDESCRIPTION\tAMOUNT\tTIMES\tSTEP\tSTATE")
+		for _, ev := range events {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d,%d,%d\t%s\n", ev.Id, ev.Date.Format("2006-01-02"), ev.Name, ev.Description, ev.Amount, ev.Times, ev.Step[0], ev.Step[1], ev.Step[2], ev.State)
+		}
+	}
+
+	return nil
+}
+
+// stats asks the api if there is one, the status file holds the same
+// but only for the current month
+func (c *client) stats(args []string) error {
+	var s stats.Stats
+
+	q, err := stats.ProcessStatsQuery(append([]string{"st"}, args...))
+	if err != nil {
+		return err
+	}
+	if q.Out != "" {
+		return fmt.Errorf("stats: out= is for the control file")
+	}
+
+	switch {
+	case c.cfg.HTTPAddr != "":
+		query := ""
+		if len(args) > 0 {
+			filters := url.Values{}
+			for _, arg := range args {
+				kv := strings.SplitN(arg, "=", 2)
+				filters.Add(kv[0], kv[1])
+			}
+			query = "?" + filters.Encode()
+		}
+
+		if err := c.get("/stats"+query, &s); err != nil {
+			return err
+		}
+	case len(args) > 0:
+		return fmt.Errorf("stats: periods need the http api")
+	default:
+		f, err := os.Open(c.cfg.StatusPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err = json.NewDecoder(f).Decode(&s); err != nil && err != io.EOF {
+			return fmt.Errorf("status file: %s", err)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	defer w.Flush()
+
+	if s.Period != nil {
+		fmt.Fprintf(w, "from\t%s\t\n", s.Period.From.Format("2006-01-02"))
+		fmt.Fprintf(w, "to\t%s\t\n\t\t\n", s.Period.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	fmt.Fprintf(w, "treasury\t%s\t\n", s.Treasury.Total)
+	fmt.Fprintf(w, "income\t%s\t\n", s.Income.Total)
+	fmt.Fprintf(w, "expenses\t%s\t\n", s.Expenses.Total)
+	fmt.Fprintf(w, "balance\t%s\t\n", s.Balance)
+
+	if len(s.Accounts) > 0 {
+		fmt.Fprintln(w, "\t\t")
+		for _, ac := range s.Accounts {
+			fmt.Fprintf(w, "%s (%s)\t%s\t\n", ac.Name, ac.Kind, ac.Total)
+		}
+	}
+
+	if len(s.Budgets) > 0 {
+		fmt.Fprintln(w, "\t\t\t\t")
+		fmt.Fprintln(w, "budget\tlimit\tspent\tremaining\t")
+		for _, b := range s.Budgets {
+			over := ""
+			if b.Over {
+				over = " !"
+			}
+			fmt.Fprintf(w, "%s %s%s\t%s\t%s\t%s\t\n", b.Kind, b.Match, over, b.Limit, b.Spent, b.Remaining)
+		}
+	}
+
+	if len(s.History) > 0 {
+		fmt.Fprintln(w, "\t\t\t\t\t")
+		fmt.Fprintln(w, "month\ttreasury\tincome\texpenses\tbalance\t")
+		for _, m := range s.History {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", m.Month, m.Treasury, m.Income, m.Expenses, m.Balance)
+		}
+	}
+
+	if len(s.Unconverted) > 0 {
+		fmt.Fprintf(w, "\t\t\nwithout rate: %s\n", strings.Join(s.Unconverted, ", "))
+	}
+
+	return nil
+}
+
+func (c *client) forecast(args []string) error {
+	q, err := stats.ProcessForecastQuery(append([]string{"fc"}, args...))
+	if err != nil {
+		return err
+	}
+	if q.Out != "" {
+		return fmt.Errorf("forecast: out= is for the control file")
+	}
+
+	query := fmt.Sprintf("?months=%d", q.Months)
+	if q.Daily {
+		query += "&by=day"
+	}
+
+	var f stats.Forecast
+	if err := c.get("/forecast"+query, &f); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	defer w.Flush()
+
+	layout := "2006-01"
+	if q.Daily {
+		layout = "2006-01-02"
+	}
+
+	fmt.Fprintf(w, "today\t\t%s\t\n", f.Treasury)
+	for _, p := range f.Points {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", p.Date.Format(layout), p.Change, p.Balance)
+	}
+	fmt.Fprintf(w, "\t\t\t\nlowest\t%s\t%s\t\n", f.Lowest.Date.Format("2006-01-02"), f.Lowest.Balance)
+
+	if len(f.Unconverted) > 0 {
+		fmt.Fprintf(w, "\t\t\t\nwithout rate: %s\n", strings.Join(f.Unconverted, ", "))
+	}
+
+	return nil
+}
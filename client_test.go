@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+)
+
+// stdout runs the client command and returns what it printed, with the
+// columns a single space apart
+func stdout(t *testing.T, cfg *config.Config, args ...string) (string, error) {
+	out, err := output(t, cfg, args...)
+
+	var lines []string
+	for _, l := range strings.Split(out, "\n") {
+		lines = append(lines, strings.Join(strings.Fields(l), " "))
+	}
+
+	return strings.Join(lines, "\n"), err
+}
+
+// output runs the client command and returns what it printed
+func output(t *testing.T, cfg *config.Config, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := os.Stdout
+	os.Stdout = w
+	err = runClient(cfg, args)
+	os.Stdout = out
+	w.Close()
+
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+
+	return string(b), err
+}
+
+func TestClientHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	srv := httptest.NewServer(d.api())
+	defer srv.Close()
+
+	cfg := &config.Config{HTTPAddr: strings.TrimPrefix(srv.URL, "http://"), Timeout: 5 * time.Second}
+
+	cases := []struct {
+		Args []string
+		Out  string
+		Ok   bool
+	}{
+		{[]string{"add", "tr", "market", "weekly shop", "2020-01-10", "-30", "cat=food"}, "added tr 0\n", true},
+		{[]string{"add", "ev", "rent", "", "2020-02-01", "-1", "0,1,0", "-500"}, "added ev 0\n", true},
+		{[]string{"add", "tr", "payroll", "", "2020-01-01", "1000"}, "added tr 1\n", true},
+		{[]string{"rm", "tr", "1"}, "removed tr 1\n", true},
+		// refused by the client or by the daemon
+		{[]string{"add", "tr", "foo", "bar", "2020-13-01", "200"}, "", false},
+		{[]string{"add", "tr", "foo", "bar", "2020-01-01", "200", "acc=nope"}, "", false},
+		{[]string{"rm", "tr", "7"}, "", false},
+		{[]string{"stats", "out=x"}, "", false},
+		{[]string{"list", "foo=bar"}, "", false},
+	}
+	for i, c := range cases {
+		out, err := stdout(t, cfg, c.Args...)
+		if (err == nil) != c.Ok {
+			t.Errorf("%d: got error %v", i, err)
+			continue
+		}
+		if out != c.Out {
+			t.Errorf("%d: got %q and should be %q", i, out, c.Out)
+		}
+	}
+
+	out, err := stdout(t, cfg, "list", "tr", "name=mark*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "weekly shop") {
+		t.Errorf("got\n%s", out)
+	}
+
+	out, err = stdout(t, cfg, "list", "ev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "0,1,0") || !strings.Contains(out, "active") {
+		t.Errorf("got\n%s", out)
+	}
+
+	out, err = stdout(t, cfg, "stats", "period=2020-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "from 2020-01-01") || !strings.Contains(out, "treasury -30.00") {
+		t.Errorf("got\n%s", out)
+	}
+
+	out, err = stdout(t, cfg, "forecast", "months=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "lowest 2020-03-01 -1030.00") {
+		t.Errorf("got\n%s", out)
+	}
+}
+
+func TestClientSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	d.cfg.SocketPath = filepath.Join(dir, "sock")
+	if err = d.listenSocket(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.sock.Close()
+
+	cfg := &config.Config{SocketPath: d.cfg.SocketPath, StatusPath: d.cfg.StatusPath, Timeout: 5 * time.Second}
+
+	c := &client{cfg: cfg}
+	if id, err := c.send([]string{"ac", "cash", "cash"}); err != nil || id != 0 {
+		t.Errorf("got %d: %v", id, err)
+	}
+	for i := uint(0); i < 2; i++ {
+		id, err := c.send([]string{"tr", "market", "weekly shop", "2020-01-10", "-30", "acc=cash"})
+		if err != nil || id != i {
+			t.Errorf("got %d: %v", id, err)
+		}
+	}
+	if _, err = c.send([]string{"tr", "market", "", "2020-01-10", "-30", "acc=nope"}); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("got %v", err)
+	}
+
+	// the status file is read without the api
+	out, err := stdout(t, cfg, "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "treasury -60.00") || !strings.Contains(out, "cash (cash) -60.00") {
+		t.Errorf("got\n%s", out)
+	}
+
+	for _, args := range [][]string{{"list"}, {"stats", "period=2020"}, {"forecast"}} {
+		if _, err = stdout(t, cfg, args...); err == nil {
+			t.Errorf("%v should need the http api", args)
+		}
+	}
+}
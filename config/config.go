@@ -1,18 +1,31 @@
 package config
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	StatusPath  string
 	CtlFilePath string
+	JournalPath string
 	Timeout     time.Duration
+	MinorUnits  int                 // decimal places of every amount
+	Currency    string              // base currency, empty if not set
+	RatesPath   string              // exchange rates table, empty if not set
+	ReplyPath   string              // answers to queries
+	NinePAddr   string              // 9P dial string, empty to not serve files
+	HTTPAddr    string              // address of the http api, empty to not serve it
+	SocketPath  string              // unix socket taking commands, empty to not listen
+	History     int                 // months summed up in the status file
+	Profiles    map[string]*Profile // csv import profiles by name
 }
 
 // errors
@@ -25,17 +38,204 @@ func (e ErrCfgFormat) Error() string {
 var ErrConfigFormat ErrCfgFormat
 var ErrConfigFilePath = errors.New("No valid configuration file path provided")
 
+/*
+* # comments start with a hash
+* status  = /var/lib/domestic-advisor/status.json
+* ctl     = /run/domestic-advisor/ctl
+* journal = /var/lib/domestic-advisor/journal
+* timeout = 10s
+* minorunits = 2
+* currency = EUR
+* rates = /var/lib/domestic-advisor/rates
+* reply = /run/domestic-advisor/reply
+* 9p = unix!/run/domestic-advisor/9p
+* http = localhost:8080
+* socket = /run/domestic-advisor/sock
+* history = 12
+* profile.bank.date = 1   # see setProfile
+*
+* relative paths are taken from the directory of the config file
+ */
 func GetConfig(args []string) (cfg *Config, err error) {
-	statusPath, _ := filepath.Abs("./status.json")
-	ctlFilePath, _ := filepath.Abs("./ctl")
-
-	return &Config{
-		statusPath,
-		ctlFilePath,
-		10,
-	}, nil
+	if len(args) < 2 || args[1] == "" {
+		return nil, ErrConfigFilePath
+	}
+
+	path, err := filepath.Abs(args[1])
+	if err != nil {
+		return nil, ErrConfigFilePath
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f, filepath.Dir(path))
+}
+
+func parse(r io.Reader, dir string) (*Config, error) {
+	// the files are next to the config file unless it says otherwise
+	cfg := &Config{
+		filepath.Join(dir, "status.json"),
+		filepath.Join(dir, "ctl"),
+		filepath.Join(dir, "journal"),
+		10 * time.Second,
+		2,
+		"",
+		"",
+		filepath.Join(dir, "reply"),
+		"",
+		"",
+		"",
+		0,
+		make(map[string]*Profile),
+	}
+
+	// line where each profile starts, to point at incomplete ones
+	profileLines := make(map[string]int)
+
+	setPath := func(dst *string) func(string) error {
+		return func(value string) error {
+			if !filepath.IsAbs(value) {
+				value = filepath.Join(dir, value)
+			}
+			*dst = filepath.Clean(value)
+			return nil
+		}
+	}
+
+	options := map[string]func(string) error{
+		"status":  setPath(&cfg.StatusPath),
+		"ctl":     setPath(&cfg.CtlFilePath),
+		"journal": setPath(&cfg.JournalPath),
+		"timeout": func(value string) (err error) {
+			cfg.Timeout, err = time.ParseDuration(value)
+			return
+		},
+		"minorunits": func(value string) (err error) {
+			cfg.MinorUnits, err = strconv.Atoi(value)
+			if err == nil && (cfg.MinorUnits < 0 || cfg.MinorUnits > 9) {
+				err = fmt.Errorf("minor units go from 0 to 9")
+			}
+			return
+		},
+		"currency": func(value string) error {
+			cfg.Currency = strings.ToUpper(value)
+			if !isCurrency(cfg.Currency) {
+				return fmt.Errorf("%q is not an ISO 4217 code", value)
+			}
+			return nil
+		},
+		"rates": setPath(&cfg.RatesPath),
+		"reply": setPath(&cfg.ReplyPath),
+		"9p": func(value string) error {
+			cfg.NinePAddr = value
+			return nil
+		},
+		"http": func(value string) error {
+			cfg.HTTPAddr = value
+			return nil
+		},
+		"socket": setPath(&cfg.SocketPath),
+		"history": func(value string) (err error) {
+			cfg.History, err = strconv.Atoi(value)
+			if err == nil && cfg.History < 0 {
+				err = fmt.Errorf("history can't be negative")
+			}
+			return
+		},
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		// strip comments
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		// key = value
+		kv := strings.SplitN(text, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrCfgFormat(line)
+		}
+
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+		if value == "" {
+			return nil, ErrCfgFormat(line)
+		}
+
+		if strings.HasPrefix(key, "profile.") {
+			if err := setProfile(cfg.Profiles, key, value); err != nil {
+				return nil, ErrCfgFormat(line)
+			}
+
+			name := strings.Split(key, ".")[1]
+			if _, ok := profileLines[name]; !ok {
+				profileLines[name] = line
+			}
+			continue
+		}
+
+		set, ok := options[key]
+		if !ok {
+			return nil, ErrCfgFormat(line)
+		}
+
+		if err := set(value); err != nil {
+			return nil, ErrCfgFormat(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading config: %s", err)
+	}
+
+	for name, p := range cfg.Profiles {
+		if err := p.check(); err != nil {
+			return nil, ErrCfgFormat(profileLines[name])
+		}
+	}
+
+	return cfg, nil
+}
+
+// isCurrency tells if code looks like an ISO 4217 code
+func isCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
 }
 
 func Usage() {
-	fmt.Println("usage:", os.Args[0], "config_file")
+	fmt.Println("usage:", os.Args[0], "config_file [command]")
+	fmt.Println()
+	fmt.Println("without a command the daemon is started, commands talk to it:")
+	fmt.Println("  add tr <name> <description> <date> <amount> [options]")
+	fmt.Println("  add ev <name> <description> <date> <times> <step> <amount> [options]")
+	fmt.Println("  rm <tr|ev> <id>")
+	fmt.Println("  list [tr|ev] [<filter>=<value>]...")
+	fmt.Println("  stats [period=<yyyy|yyyy-qN|yyyy-mm>] [from=<date> to=<date>]")
+	fmt.Println("  forecast [months=<n>] [by=<day|month>]")
+	fmt.Println("  import csv <profile> <file>")
+	fmt.Println("  import ofx <file> [acc=<account>] [cat=<category>]")
+	fmt.Println("  import ledger <file>")
+	fmt.Println("  export ledger|ics")
 }
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	in := `# domestic advisor
+status = /var/lib/da/status.json
+ctl=run/ctl   # relative to the config file
+
+journal =   /var/lib/da/journal
+timeout = 1m30s
+minorunits = 3
+currency = usd
+rates = rates.txt
+reply = /run/da/reply
+9p = tcp!localhost!5640
+http = :8080
+socket = sock
+history = 6
+
+profile.bank.comma = ;
+profile.bank.skip = 1
+profile.bank.date = 1
+profile.bank.dateformat = 02/01/2006
+profile.bank.payee = 2
+profile.bank.debit = 4
+profile.bank.credit = 5
+profile.bank.decimal = ,
+profile.bank.thousands = .
+profile.bank.account = checking
+profile.card.date = 2
+profile.card.description = 3
+profile.card.amount = 4
+profile.card.currency = usd
+`
+
+	cfg, err := parse(strings.NewReader(in), "/etc/da")
+	if err != nil {
+		t.Fatalf("failed: %s", err)
+	}
+
+	if cfg.StatusPath != "/var/lib/da/status.json" {
+		t.Errorf("status is %s", cfg.StatusPath)
+	}
+	if cfg.CtlFilePath != "/etc/da/run/ctl" {
+		t.Errorf("ctl is %s", cfg.CtlFilePath)
+	}
+	if cfg.JournalPath != "/var/lib/da/journal" {
+		t.Errorf("journal is %s", cfg.JournalPath)
+	}
+	if cfg.Timeout != 90*time.Second {
+		t.Errorf("timeout is %s", cfg.Timeout)
+	}
+	if cfg.MinorUnits != 3 {
+		t.Errorf("minor units is %d", cfg.MinorUnits)
+	}
+	if cfg.Currency != "USD" {
+		t.Errorf("currency is %s", cfg.Currency)
+	}
+	if cfg.RatesPath != "/etc/da/rates.txt" {
+		t.Errorf("rates is %s", cfg.RatesPath)
+	}
+	if cfg.ReplyPath != "/run/da/reply" {
+		t.Errorf("reply is %s", cfg.ReplyPath)
+	}
+	if cfg.NinePAddr != "tcp!localhost!5640" {
+		t.Errorf("9p is %s", cfg.NinePAddr)
+	}
+	if cfg.HTTPAddr != ":8080" {
+		t.Errorf("http is %s", cfg.HTTPAddr)
+	}
+	if cfg.SocketPath != "/etc/da/sock" {
+		t.Errorf("socket is %s", cfg.SocketPath)
+	}
+	if cfg.History != 6 {
+		t.Errorf("history is %d", cfg.History)
+	}
+
+	bank := Profile{';', 1, 1, "02/01/2006", 2, 0, 0, 4, 5, ',', '.', "", "checking", ""}
+	card := Profile{',', 0, 2, "2006-01-02", 0, 3, 4, 0, 0, '.', 0, "USD", "", ""}
+	if len(cfg.Profiles) != 2 || *cfg.Profiles["bank"] != bank || *cfg.Profiles["card"] != card {
+		t.Errorf("profiles are %+v %+v", cfg.Profiles["bank"], cfg.Profiles["card"])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		Input string
+		Line  int
+	}{
+		{"status /tmp/status.json", 1},
+		{"# ok\n\nfoo = bar", 3},
+		{"status =", 1},
+		{"ctl = /tmp/ctl\ntimeout = soon", 2},
+		{"minorunits = -1", 1},
+		{"minorunits = 10", 1},
+		{"currency = euro", 1},
+		{"# base\ncurrency = E1R", 2},
+		{"history = -1", 1},
+		{"profile.bank.foo = 1", 1},
+		{"profile.bank = 1", 1},
+		{"profile.bank.date = 0", 1},
+		{"profile.bank.decimal = ,,", 1},
+		// incomplete profiles point at their first line
+		{"ctl = /tmp/ctl\nprofile.bank.date = 1\nprofile.bank.payee = 2", 2},
+		{"profile.a.date = 1\nprofile.a.payee = 2\nprofile.a.amount = 3\nprofile.a.debit = 4", 1},
+	}
+
+	for i, c := range cases {
+		_, err := parse(strings.NewReader(c.Input), "/")
+		if err == nil {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+
+		e, ok := err.(ErrCfgFormat)
+		if !ok {
+			t.Errorf("%d: got %s and should be a format error", i, err)
+			continue
+		}
+		if int(e) != c.Line {
+			t.Errorf("%d: error at line %d and should be %d", i, int(e), c.Line)
+		}
+	}
+}
+
+// files left out of the config file are next to it
+func TestParseDefaults(t *testing.T) {
+	cfg, err := parse(strings.NewReader("ctl = /run/da/ctl\n"), "/etc/da")
+	if err != nil {
+		t.Fatalf("failed: %s", err)
+	}
+
+	if cfg.StatusPath != "/etc/da/status.json" || cfg.JournalPath != "/etc/da/journal" || cfg.ReplyPath != "/etc/da/reply" {
+		t.Errorf("got %+v", cfg)
+	}
+	if cfg.CtlFilePath != "/run/da/ctl" {
+		t.Errorf("ctl is %s", cfg.CtlFilePath)
+	}
+}
+
+func TestGetConfigNoPath(t *testing.T) {
+	if _, err := GetConfig([]string{"domestic-advisor"}); err != ErrConfigFilePath {
+		t.Errorf("got %v and should be %s", err, ErrConfigFilePath)
+	}
+}
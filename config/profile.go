@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Profile maps the columns of a bank statement in csv onto transactions,
+// columns are counted from 1 and 0 means the column is missing
+type Profile struct {
+	Comma       rune
+	Skip        int // lines before the first row, like a header
+	Date        int
+	DateFormat  string // layout of time.Parse
+	Payee       int
+	Description int
+	// either a single column with signed amounts or a column for money
+	// going out and another for money coming in
+	Amount    int
+	Debit     int
+	Credit    int
+	Decimal   byte // decimal separator
+	Thousands byte // thousands separator, 0 if there is none
+	// attributes given to every transaction
+	Currency string
+	Account  string
+	Category string
+}
+
+/*
+* profile.<name>.<field> = <value>
+*
+* profile.bank.comma = ;
+* profile.bank.skip = 1
+* profile.bank.date = 1
+* profile.bank.dateformat = 02/01/2006
+* profile.bank.payee = 2
+* profile.bank.description = 3
+* profile.bank.debit = 4
+* profile.bank.credit = 5
+* profile.bank.decimal = ,
+* profile.bank.thousands = .
+* profile.bank.account = checking
+ */
+func setProfile(profiles map[string]*Profile, key, value string) error {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 || parts[1] == "" {
+		return fmt.Errorf("%s is not a profile field", key)
+	}
+
+	p, ok := profiles[parts[1]]
+	if !ok {
+		p = &Profile{Comma: ',', DateFormat: "2006-01-02", Decimal: '.'}
+		profiles[parts[1]] = p
+	}
+
+	column := func(dst *int) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("columns start at 1")
+		}
+		*dst = n
+		return nil
+	}
+
+	char := func() (byte, error) {
+		if len(value) != 1 {
+			return 0, fmt.Errorf("%q is not a single character", value)
+		}
+		return value[0], nil
+	}
+
+	var err error
+
+	switch parts[2] {
+	case "comma":
+		// spaces are trimmed from values
+		if value == "tab" {
+			value = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(value)
+		if size != len(value) || r == '"' || r == '\n' {
+			return fmt.Errorf("%q is not a valid separator", value)
+		}
+		p.Comma = r
+	case "skip":
+		p.Skip, err = strconv.Atoi(value)
+		if err == nil && p.Skip < 0 {
+			err = fmt.Errorf("skip can't be negative")
+		}
+	case "date":
+		err = column(&p.Date)
+	case "dateformat":
+		p.DateFormat = value
+	case "payee":
+		err = column(&p.Payee)
+	case "description":
+		err = column(&p.Description)
+	case "amount":
+		err = column(&p.Amount)
+	case "debit":
+		err = column(&p.Debit)
+	case "credit":
+		err = column(&p.Credit)
+	case "decimal":
+		p.Decimal, err = char()
+	case "thousands":
+		p.Thousands, err = char()
+	case "currency":
+		p.Currency = strings.ToUpper(value)
+	case "account":
+		p.Account = value
+	case "category":
+		p.Category = value
+	default:
+		return fmt.Errorf("%s is not a profile field", parts[2])
+	}
+
+	return err
+}
+
+// check tells if the profile has enough columns to build transactions
+func (p *Profile) check() error {
+	if p.Date == 0 {
+		return fmt.Errorf("missing date column")
+	}
+	if p.Payee == 0 && p.Description == 0 {
+		return fmt.Errorf("missing payee or description column")
+	}
+	if p.Amount == 0 && p.Debit == 0 && p.Credit == 0 {
+		return fmt.Errorf("missing amount, debit or credit column")
+	}
+	if p.Amount != 0 && (p.Debit != 0 || p.Credit != 0) {
+		return fmt.Errorf("amount can't be used with debit or credit")
+	}
+	if p.Decimal == p.Thousands {
+		return fmt.Errorf("decimal and thousands separators are the same")
+	}
+
+	return nil
+}
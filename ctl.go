@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ctlOffset is how far the control file was read, kept in a file next to
+// the journal so the lines of the control file are applied once across
+// restarts. The control file is known by its inode: one moved with mv is
+// still the same file, a new or truncated one is read from the start.
+type ctlOffset struct {
+	path string // file the offset is kept in
+	ino  uint64
+	n    int64
+}
+
+/*
+* <inode> <offset>
+* 1837461 1042
+ */
+func loadCtlOffset(path string) (*ctlOffset, error) {
+	o := &ctlOffset{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fscan(f, &o.ino, &o.n); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return o, nil
+}
+
+// skip returns how many bytes of the control file at ctlPath were read
+// already, it is called every time the file is read from the start
+func (o *ctlOffset) skip(ctlPath string) int64 {
+	fi, err := os.Stat(ctlPath)
+	if err != nil {
+		o.ino, o.n = 0, 0
+		return 0
+	}
+
+	ino := inode(fi)
+	if ino != o.ino || fi.Size() < o.n {
+		o.ino, o.n = ino, 0
+	}
+
+	return o.n
+}
+
+// save records that the first n bytes of the control file were read, the
+// file is replaced whole so a crash never leaves half an offset
+func (o *ctlOffset) save(n int64) error {
+	o.n = n
+
+	f, err := os.Create(o.path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "%d %d\n", o.ino, o.n)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(o.path+".tmp", o.path)
+}
+
+func inode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
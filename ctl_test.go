@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCtlOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctl_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctl := filepath.Join(dir, "ctl")
+	path := filepath.Join(dir, "journal.ctl")
+
+	write := func(name, s string, flag int) {
+		f, err := os.OpenFile(name, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err = f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() *ctlOffset {
+		o, err := loadCtlOffset(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	// nothing read yet
+	write(ctl, "tr a \"\" 2020-01-01 1\n", os.O_TRUNC)
+	o := load()
+	if n := o.skip(ctl); n != 0 {
+		t.Errorf("got %d", n)
+	}
+	if err = o.save(21); err != nil {
+		t.Fatal(err)
+	}
+
+	// lines added while the daemon was stopped are read
+	write(ctl, "tr b \"\" 2020-01-01 1\n", os.O_APPEND)
+	if n := load().skip(ctl); n != 21 {
+		t.Errorf("got %d", n)
+	}
+
+	// moved with mv it is the same file
+	moved := filepath.Join(dir, "ctl2")
+	if err = os.Rename(ctl, moved); err != nil {
+		t.Fatal(err)
+	}
+	if n := load().skip(moved); n != 21 {
+		t.Errorf("got %d", n)
+	}
+
+	// a new file at the old path is read from the start
+	write(ctl, "tr c \"\" 2020-01-01 1\ntr d \"\" 2020-01-01 1\n", os.O_TRUNC)
+	o = load()
+	if n := o.skip(ctl); n != 0 {
+		t.Errorf("got %d", n)
+	}
+	if err = o.save(42); err != nil {
+		t.Fatal(err)
+	}
+
+	// and so is a truncated one
+	write(ctl, "tr e \"\" 2020-01-01 1\n", os.O_TRUNC)
+	if n := load().skip(ctl); n != 0 {
+		t.Errorf("got %d", n)
+	}
+
+	write(path, "garbage", os.O_TRUNC)
+	if _, err = loadCtlOffset(path); err == nil {
+		t.Errorf("garbage should have been refused")
+	}
+}
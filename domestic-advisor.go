@@ -2,17 +2,28 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/journal"
 	"github.com/argot42/DomesticAdvisor/stats"
 	"github.com/argot42/watcher"
 )
 
+// how often missed occurrences are looked for, timers alone are not enough
+// since they don't account for the time the machine spent suspended
+const catchUpInterval = time.Minute
+
 func main() {
     cfg, err := config.GetConfig(os.Args)
     if err != nil {
@@ -22,67 +33,571 @@ func main() {
         }
         log.Fatalln("config:", err)
     }
-    ctl, status, err := setupFiles(cfg)
+    if err = stats.SetMinorUnits(cfg.MinorUnits); err != nil {
+        log.Fatalln("config:", err)
+    }
+
+    // anything after the config file is a command for a running daemon
+    if len(os.Args) > 2 {
+        if err = runClient(cfg, os.Args[2:]); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
+
+    settings, err := loadSettings(cfg)
+    if err != nil {
+        log.Fatalln("config:", err)
+    }
+    // how far the control file was read before the last stop
+    ctlRead, err := loadCtlOffset(cfg.JournalPath + ".ctl")
+    if err != nil {
+        log.Fatalln("control file offset:", err)
+    }
+
+    ctl, status, reply, jrnl, err := setupFiles(cfg)
     if err != nil {
         log.Fatalln("setup:", err)
     }
 
-    // sigterm setup
+    // sigterm and sighup setup
     sigs := make(chan os.Signal, 1)
-    signal.Notify(sigs, syscall.SIGTERM)
-
-    // timer setup
-    timer := make(chan stats.Timer, 10)
+    signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+
+    clock := stats.RealClock
+    settings.Clock = clock
+
+    d := &daemon{
+        cfg:      cfg,
+        settings: settings,
+        ctl:      ctl,
+        status:   status,
+        reply:    reply,
+        jrnl:     jrnl,
+        clock:    clock,
+        // timer setup
+        sched:    stats.NewScheduler(clock),
+        cmds:     make(chan command),
+        done:     make(chan struct{}),
+        ctlRead:  ctlRead,
+    }
 
-    if err = start(ctl, timer, status, cfg.Timeout, sigs); err != nil {
+    if err = start(d, sigs); err != nil {
         log.Fatalln("runtime:", err)
     }
 
     // cleaning
     log.Println("Closing")
-    status.Close()
-    ctl.Done <- true
+    d.sched.Stop()
+    d.status.Close()
+    d.reply.Close()
+    d.jrnl.Close()
     // wait for the goroutines to end
     log.Println("Wating for goroutines to finish")
+    stopWatcher(d.ctl)
+    log.Println("bye :)")
+}
+
+func setupFiles(cfg *config.Config) (ctl watcher.R, status, reply *os.File, jrnl *journal.Journal, err error) {
+    // open journal
+    jrnl, e := journal.Open(cfg.JournalPath)
+    if e != nil {
+        err = fmt.Errorf("journal file: %s", e)
+        return
+    }
+
+    // create status file
+    status, e = os.Create(cfg.StatusPath)
+    if e != nil {
+        jrnl.Close()
+        err = fmt.Errorf("status file: %s", e)
+        return
+    }
+
+    // create reply file
+    reply, e = os.Create(cfg.ReplyPath)
+    if e != nil {
+        jrnl.Close()
+        status.Close()
+        err = fmt.Errorf("reply file: %s", e)
+        return
+    }
+
+    // watch control file
+    ctl = watcher.Read(cfg.CtlFilePath)
+
+    return
+}
+
+// loadSettings gathers what BuildStats needs from the configuration
+func loadSettings(cfg *config.Config) (settings stats.Settings, err error) {
+    settings.Base = cfg.Currency
+    settings.History = cfg.History
+
+    if cfg.RatesPath == "" {
+        return
+    }
+
+    f, err := os.Open(cfg.RatesPath)
+    if err != nil {
+        err = fmt.Errorf("rates file: %s", err)
+        return
+    }
+    defer f.Close()
+
+    settings.Rates, err = stats.LoadRates(f)
+    return
+}
+
+// stopWatcher tells the watcher to stop and waits until it does
+func stopWatcher(ctl watcher.R) {
+    ctl.Done <- true
     for {
         _, open := <-ctl.Out
         if !open {
             break
         }
     }
-    log.Println("bye :)")
 }
 
-func setupFiles(cfg *config.Config) (ctl watcher.R, status *os.File, err error) {
-    // watch control file
-    ctl = watcher.Read(cfg.CtlFilePath)
+/* everything the main loop works with */
+type daemon struct {
+    cfg      *config.Config
+    settings stats.Settings
+    ctl      watcher.R
+    status   *os.File
+    reply    *os.File
+    jrnl     *journal.Journal
+    clock    stats.Clock
+    sched    *stats.Scheduler
+    ledger   *stats.Ledger
+    // commands coming from other goroutines
+    cmds     chan command
+    // closed once the main loop is over
+    done     chan struct{}
+    ninep    net.Listener
+    http     *http.Server
+    sock     net.Listener
+    ctlRead  *ctlOffset
+}
 
-    // create status file
-    status, e := os.Create(cfg.StatusPath)
-    if e != nil {
-        err = fmt.Errorf("status file: %s", e)
+// reload reads the configuration again and swaps the files whose path
+// changed, the state and the pending timers are left untouched
+func (d *daemon) reload() error {
+    cfg, err := config.GetConfig(os.Args)
+    if err != nil {
+        return err
+    }
+
+    return d.reconfigure(cfg)
+}
+
+// reconfigure moves the daemon to cfg. Everything the new configuration
+// needs is opened before anything is swapped, so a failure leaves the
+// daemon as it was.
+func (d *daemon) reconfigure(cfg *config.Config) error {
+    // the journal holds the state, moving it means starting from scratch
+    if cfg.JournalPath != d.cfg.JournalPath {
+        log.Printf("journal path changed to %s, it will be used after a restart\n", cfg.JournalPath)
+        cfg.JournalPath = d.cfg.JournalPath
+    }
+
+    // amounts in memory were parsed with the old minor units
+    if cfg.MinorUnits != d.cfg.MinorUnits {
+        log.Printf("minor units changed to %d, they will be used after a restart\n", cfg.MinorUnits)
+        cfg.MinorUnits = d.cfg.MinorUnits
+    }
+
+    // the rates table is read again even if its path didn't change
+    settings, err := loadSettings(cfg)
+    if err != nil {
+        return err
+    }
+
+    var status, reply *os.File
+    var ninepL, httpL, sockL net.Listener
+
+    // what was opened is closed again if anything else fails
+    abort := func(err error) error {
+        for _, f := range []*os.File{status, reply} {
+            if f != nil {
+                f.Close()
+            }
+        }
+        for _, l := range []net.Listener{ninepL, httpL, sockL} {
+            if l != nil {
+                l.Close()
+            }
+        }
+        return err
+    }
+
+    if cfg.StatusPath != d.cfg.StatusPath {
+        if status, err = os.Create(cfg.StatusPath); err != nil {
+            return abort(fmt.Errorf("status file: %s", err))
+        }
+    }
+
+    if cfg.ReplyPath != d.cfg.ReplyPath {
+        if reply, err = os.Create(cfg.ReplyPath); err != nil {
+            return abort(fmt.Errorf("reply file: %s", err))
+        }
+    }
+
+    if cfg.NinePAddr != d.cfg.NinePAddr {
+        if ninepL, err = open9P(cfg.NinePAddr); err != nil {
+            return abort(err)
+        }
+    }
+
+    if cfg.HTTPAddr != d.cfg.HTTPAddr {
+        if httpL, err = openHTTP(cfg.HTTPAddr); err != nil {
+            return abort(err)
+        }
+    }
+
+    if cfg.SocketPath != d.cfg.SocketPath {
+        if sockL, err = openSocket(cfg.SocketPath); err != nil {
+            return abort(err)
+        }
+    }
+
+    // nothing fails from here on
+    old := d.cfg
+    d.cfg = cfg
+    d.settings = settings
+    d.settings.Clock = d.clock
+    d.ledger.SetSettings(d.settings)
+
+    if status != nil {
+        d.status.Close()
+        d.status = status
+        log.Println("status file moved to", cfg.StatusPath)
+    }
+
+    if reply != nil {
+        d.reply.Close()
+        d.reply = reply
+        log.Println("reply file moved to", cfg.ReplyPath)
+    }
+
+    if cfg.CtlFilePath != old.CtlFilePath {
+        stopWatcher(d.ctl)
+        d.ctl = watcher.Read(cfg.CtlFilePath)
+        log.Println("control file moved to", cfg.CtlFilePath)
+    }
+
+    if cfg.NinePAddr != old.NinePAddr {
+        d.serve9P(ninepL)
+    }
+
+    if cfg.HTTPAddr != old.HTTPAddr {
+        d.serveHTTP(httpL)
+    }
+
+    if cfg.SocketPath != old.SocketPath {
+        d.serveSocket(sockL)
+    }
+
+    return d.updateStats()
+}
+
+// reschedule sets the timer of the event to its date, or removes it if
+// the event doesn't have to fire anymore
+func (d *daemon) reschedule(id uint) {
+    ev, ok := d.ledger.Event(id)
+    if !ok {
+        d.sched.Remove(id)
         return
     }
 
-    return
+    if ev.State != stats.Active || ev.Times == 0 {
+        d.sched.Remove(id)
+        return
+    }
+
+    d.sched.Add(id, ev.Date)
+}
+
+func (d *daemon) updateStats() error {
+    return stats.UpdateStats(d.ledger.Stats(), d.status)
+}
+
+// apply runs a command the same way wherever it came from, rejected is
+// the reason the command was not accepted and err a failure that should
+// stop the daemon
+func (d *daemon) apply(parsed []string) (res stats.Result, rejected, err error) {
+    // queries don't change anything, they are not journaled
+    switch parsed[0] {
+    case "q":
+        return res, d.query(parsed), nil
+    case "st":
+        return res, d.periodStats(parsed), nil
+    case "fc":
+        return res, d.forecast(parsed), nil
+    }
+
+    // resuming depends on when it happened, keep it for the journal
+    if parsed[0] == "resume" && len(parsed) == 3 {
+        parsed = append(parsed, d.clock.Now().Format(time.RFC3339Nano))
+    }
+
+    res, rejected = d.ledger.Exec(parsed)
+    if rejected != nil {
+        return res, rejected, nil
+    }
+
+    // only accepted commands make it to the journal
+    if err = d.jrnl.Append(parsed); err != nil {
+        return res, nil, fmt.Errorf("journal: %s", err)
+    }
+
+    for _, id := range res.Changed {
+        d.reschedule(id)
+    }
+
+    if err = d.updateStats(); err != nil {
+        return res, nil, fmt.Errorf("status update: %s", err)
+    }
+
+    return res, nil, nil
+}
+
+// command is a line handed to the main loop by a goroutine that waits for
+// its outcome
+type command struct {
+    parsed []string
+    reply  chan outcome
 }
 
-func start(ctl watcher.R, timer chan stats.Timer, status *os.File, timeout time.Duration, sigs chan os.Signal) error {
+type outcome struct {
+    res      stats.Result
+    rejected error
+}
+
+var errStopped = errors.New("daemon stopped")
+
+// submit runs the command on the main loop and returns what it did or why
+// it was rejected
+func (d *daemon) submit(parsed []string) (stats.Result, error) {
+    cmd := command{parsed, make(chan outcome, 1)}
+
+    select {
+    case d.cmds <- cmd:
+    case <-d.done:
+        return stats.Result{}, errStopped
+    }
+
+    select {
+    case o := <-cmd.reply:
+        return o.res, o.rejected
+    case <-d.done:
+        return stats.Result{}, errStopped
+    }
+}
+
+// query answers a q command in the reply file, or in the file given with
+// out= in the directory of the reply file
+func (d *daemon) query(parsed []string) error {
+    q, err := stats.ProcessQuery(parsed)
+    if err != nil {
+        return err
+    }
+
+    res := d.ledger.Query(q)
+
+    return d.answer(q.Out, func(f *os.File) error {
+        return stats.WriteQuery(res, f)
+    })
+}
+
+// periodStats answers a st command with the stats of the period, in the
+// same places as a query
+func (d *daemon) periodStats(parsed []string) error {
+    q, err := stats.ProcessStatsQuery(parsed)
+    if err != nil {
+        return err
+    }
+
+    s := d.ledger.Period(q.Period)
+
+    return d.answer(q.Out, func(f *os.File) error {
+        return stats.UpdateStats(s, f)
+    })
+}
+
+// forecast answers a fc command with the projected balance
+func (d *daemon) forecast(parsed []string) error {
+    q, err := stats.ProcessForecastQuery(parsed)
+    if err != nil {
+        return err
+    }
+
+    f := d.ledger.Forecast(q)
+
+    return d.answer(q.Out, func(out *os.File) error {
+        return stats.WriteForecast(f, out)
+    })
+}
+
+// answer writes to the reply file, or to out if it is set. out is only a
+// file name, the file is put next to the reply file so commands can't
+// write anywhere else
+func (d *daemon) answer(out string, write func(*os.File) error) error {
+    if out == "" {
+        return write(d.reply)
+    }
+
+    if out == "." || out == ".." || strings.ContainsAny(out, `/\`) || filepath.IsAbs(out) {
+        return fmt.Errorf("reply: %q should be a file name", out)
+    }
+
+    path := filepath.Join(filepath.Dir(d.cfg.ReplyPath), out)
+    if d.ownFile(path) {
+        return fmt.Errorf("reply: %q is a file of the daemon", out)
+    }
+
+    f, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("reply: %s", err)
+    }
+    defer f.Close()
+
+    return write(f)
+}
+
+// ownFile tells if path is one of the files the daemon keeps, they all
+// share a directory with the reply file by default
+func (d *daemon) ownFile(path string) bool {
+    fi, _ := os.Stat(path)
+    abs, _ := filepath.Abs(path)
+
+    own := []string{
+        d.cfg.JournalPath,
+        d.cfg.JournalPath + ".ctl",
+        d.cfg.JournalPath + ".ctl.tmp",
+        d.cfg.StatusPath,
+        d.cfg.CtlFilePath,
+        d.cfg.RatesPath,
+        d.cfg.SocketPath,
+        d.cfg.ReplyPath,
+    }
+    for _, p := range own {
+        if p == "" {
+            continue
+        }
+        if a, _ := filepath.Abs(p); a == abs {
+            return true
+        }
+        // the same file under another name
+        if fi == nil {
+            continue
+        }
+        if pfi, err := os.Stat(p); err == nil && os.SameFile(fi, pfi) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// catchUp fires every occurrence that should have happened up to now and
+// journals it, it returns the occurrences that were fired
+func (d *daemon) catchUp() ([]stats.Timer, error) {
+    fired := d.ledger.CatchUp(d.clock.Now())
+
+    for _, t := range fired {
+        if err := d.jrnl.Append(fireRecord(t)); err != nil {
+            return fired, err
+        }
+    }
+
+    return fired, nil
+}
+
+func start(d *daemon, sigs chan os.Signal) error {
     /* state */
-    var transactions []stats.Transaction
-    var events []stats.Event
+    d.ledger = stats.NewLedger(d.settings)
+    ledger := d.ledger
+
+    // rebuild the state from the journal before accepting new commands
+    err := d.replay()
+    if err != nil {
+        return fmt.Errorf("journal replay: %s", err)
+    }
+
+    log.Printf("replayed %d transactions and %d events\n", len(ledger.Transactions()), len(ledger.Events()))
+
+    // materialize whatever should have happened while we were down
+    if _, err = d.catchUp(); err != nil {
+        return fmt.Errorf("catch up: %s", err)
+    }
+
+    // set up timers for every event that still has to repeat
+    for _, ev := range ledger.Events() {
+        d.reschedule(ev.Id)
+    }
+
+    ticker := time.NewTicker(catchUpInterval)
+    defer ticker.Stop()
+
+    if err = d.updateStats(); err != nil {
+        return fmt.Errorf("status update: %s", err)
+    }
+
+    // other goroutines can send commands from now on
+    defer close(d.done)
+
+    if err = d.listen9P(); err != nil {
+        return err
+    }
+    defer func() {
+        if d.ninep != nil {
+            d.ninep.Close()
+        }
+    }()
+
+    if err = d.listenHTTP(); err != nil {
+        return err
+    }
+    defer func() {
+        if d.http != nil {
+            d.http.Close()
+        }
+    }()
+
+    if err = d.listenSocket(); err != nil {
+        return err
+    }
+    defer func() {
+        if d.sock != nil {
+            d.sock.Close()
+        }
+    }()
 
     /********/
     var buffer []byte
+    // bytes of the control file read and those already applied before
+    var pos, skip int64
 
     End:
     for {
         select {
-        case input := <-ctl.Out:
-            // initialize state
+        case input := <-d.ctl.Out:
+            // the watcher reads the control file from the start, the lines
+            // applied before a restart or a move are skipped
             if input.First {
-                transactions = make([]stats.Transaction, 0, 5)
-                events = make([]stats.Event, 0, 5)
+                buffer = nil
+                pos = 0
+                skip = d.ctlRead.skip(d.cfg.CtlFilePath)
+                if skip > 0 {
+                    log.Printf("skipping %d bytes of the control file already read\n", skip)
+                }
+            }
+            pos++
+            if pos <= skip {
+                continue
             }
 
             if input.Data != 10 { // 10 is newline
@@ -94,106 +609,151 @@ func start(ctl watcher.R, timer chan stats.Timer, status *os.File, timeout time.
 
             // parse input
             parsed, err := stats.Parse(bytes.NewReader(buffer))
-            if err != nil {
-                log.Printf("parsing: %s\n", err)
-                buffer = nil
-                continue
-            }
             // clean buffer
             buffer = nil
 
-            // process input
-            switch(parsed[0]) {
-            case "tr":
-                tr, err := stats.ProcessTransaction(parsed)
+            if err != nil {
+                log.Printf("parsing: %s\n", err)
+            } else {
+                // process input
+                _, rejected, err := d.apply(parsed)
                 if err != nil {
-                    log.Println(err)
-                    continue
+                    return err
                 }
-
-                log.Printf("got transaction: %+v\n", tr)
-
-                transactions = append(transactions, tr)
-            case "ev":
-                ev, err := stats.ProcessEvent(parsed)
-                if err != nil {
-                    log.Println(err)
-                    continue
+                if rejected != nil {
+                    log.Println(rejected)
                 }
+            }
 
-                log.Printf("got event: %+v\n", ev)
-
-                events = append(events, ev)
-
-                log.Println("started timer")
-
-                stats.StartTimer(ev, time.Now(), timer)
-            default:
-                log.Println(parsed[0], "is not a cmd")
-                continue
+            // a crash before this applies the line again on restart,
+            // after the journal it is never lost
+            if err := d.ctlRead.save(pos); err != nil {
+                return fmt.Errorf("control file offset: %s", err)
             }
 
-            // update stats
-            s := stats.BuildStats(transactions, events)
+        case cmd := <-d.cmds:
+            log.Printf("recv command %q\n", cmd.parsed)
 
-            if err = stats.UpdateStats(s, status); err != nil {
-                return fmt.Errorf("status update: %s", err)
+            res, rejected, err := d.apply(cmd.parsed)
+            cmd.reply <- outcome{res, rejected}
+            if err != nil {
+                return err
             }
 
-        case t := <-timer:
+        case t := <-d.sched.C:
             log.Printf("timer triggered: %+v\n", t)
 
-            i := findEvent(t.Id, events)
-            if i < 0 {
+            ev, ok := ledger.Event(t.Id)
+            if !ok {
                 log.Printf("The event with id %d does not exist\n", t.Id)
                 break
             }
 
-            // selected event
-            ev := &events[i]
+            // the occurrence was already materialized by a catch up or the
+            // event was stopped before the timer got here
+            if !ev.Date.Equal(t.Date) || ev.Times == 0 || ev.State != stats.Active {
+                log.Printf("stale timer for event %d\n", t.Id)
+                break
+            }
+
+            if _, err := ledger.Fire(t.Id, t.Date); err != nil {
+                log.Println(err)
+                break
+            }
+
+            if err := d.jrnl.Append(fireRecord(t)); err != nil {
+                return fmt.Errorf("journal: %s", err)
+            }
+
+            // set new timer
+            d.reschedule(t.Id)
 
-            // build new transaction
-            tr := stats.BuildTransaction(ev.Name, ev.Description, t.Date, ev.Amount)
-            transactions = append(transactions, tr)
+            // update stats
+            if err := d.updateStats(); err != nil {
+                return fmt.Errorf("timer status update: %s", err)
+            }
 
-            ev.Times--
+        case <-ticker.C:
+            fired, err := d.catchUp()
+            if err != nil {
+                return fmt.Errorf("catch up: %s", err)
+            }
+            if len(fired) == 0 {
+                break
+            }
 
-            // when times reaches 0 that means the event should not keep repeating
-            // hence we only update the date and set up a new timer only if times
-            // is greater than zero or negative (that means it will keep reapeating forever)
-            if ev.Times != 0 {
-                // update date
-                newDate := ev.Date.AddDate(ev.Step[0], ev.Step[1], ev.Step[2])
-                ev.Date = newDate
+            log.Printf("caught up %d occurrences\n", len(fired))
 
-                // set new timer
-                stats.StartTimer(*ev, time.Now(), timer)
+            // the old timers are stale now
+            for _, t := range fired {
+                d.reschedule(t.Id)
             }
 
             // update stats
-            s := stats.BuildStats(transactions, events)
-
-            if err := stats.UpdateStats(s, status); err != nil {
-                return fmt.Errorf("timer status update: %s", err)
+            if err := d.updateStats(); err != nil {
+                return fmt.Errorf("catch up status update: %s", err)
             }
 
-        case err := <-ctl.Err:
+        case err := <-d.ctl.Err:
             return fmt.Errorf("control file erorr: %s", err)
 
-        case <-sigs:
-            break End
+        case sig := <-sigs:
+            if sig != syscall.SIGHUP {
+                break End
+            }
+
+            log.Println("reloading configuration")
+
+            ctlOut := d.ctl.Out
+            if err := d.reload(); err != nil {
+                log.Printf("reload: %s\n", err)
+            }
+
+            // a half read line belongs to the old control file
+            if d.ctl.Out != ctlOut {
+                buffer = nil
+            }
         }
     }
 
     return nil
 }
 
-func findEvent(id uint, events []stats.Event) int {
-    for i, ev := range events {
-        if ev.Id == id {
-            return i
+// replay applies the journal to the ledger, timers are set up once the
+// whole journal is read
+func (d *daemon) replay() error {
+    return d.jrnl.Replay(func(parsed []string) error {
+        if parsed[0] == "fire" {
+            return replayFire(d.ledger, parsed)
         }
+        _, err := d.ledger.Exec(parsed)
+        return err
+    })
+}
+
+/*
+* fire  <event id>  <date>
+* fire  3           2020-01-01T00:00:00Z
+*/
+func fireRecord(t stats.Timer) []string {
+    return []string{"fire", strconv.FormatUint(uint64(t.Id), 10), t.Date.Format(time.RFC3339Nano)}
+}
+
+func replayFire(ledger *stats.Ledger, parsed []string) error {
+    if len(parsed) < 3 {
+        return fmt.Errorf("fire: missing arguments")
+    }
+
+    id, err := strconv.ParseUint(parsed[1], 10, 0)
+    if err != nil {
+        return fmt.Errorf("fire: %s", err)
+    }
+
+    date, err := time.Parse(time.RFC3339Nano, parsed[2])
+    if err != nil {
+        return fmt.Errorf("fire: %s", err)
     }
 
-    return -1
+    _, err = ledger.Fire(uint(id), date)
+    return err
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/journal"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// testDaemon is a daemon with its files in dir and the clock at now, the
+// journal is replayed into its ledger and submitted commands are applied
+// until the test ends
+func testDaemon(t *testing.T, dir string, now time.Time) *daemon {
+	clock := stats.NewVirtualClock(now)
+
+	cfg := &config.Config{
+		StatusPath:  filepath.Join(dir, "status"),
+		ReplyPath:   filepath.Join(dir, "reply"),
+		JournalPath: filepath.Join(dir, "journal"),
+	}
+
+	status, err := os.Create(cfg.StatusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := os.Create(cfg.ReplyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jrnl, err := journal.Open(cfg.JournalPath)
+	if err != nil {
+		t.Fatalf("open journal: %s", err)
+	}
+
+	d := &daemon{
+		cfg:    cfg,
+		status: status,
+		reply:  reply,
+		jrnl:   jrnl,
+		clock:  clock,
+		sched:  stats.NewScheduler(clock),
+		ledger: stats.NewLedger(stats.Settings{Clock: clock}),
+		cmds:   make(chan command),
+		done:   make(chan struct{}),
+	}
+
+	t.Cleanup(func() {
+		close(d.done)
+		d.sched.Stop()
+		jrnl.Close()
+		// a reload may have swapped them
+		d.status.Close()
+		d.reply.Close()
+		if d.sock != nil {
+			d.sock.Close()
+		}
+	})
+
+	if err = d.replay(); err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case cmd := <-d.cmds:
+				res, rejected, _ := d.apply(cmd.parsed)
+				cmd.reply <- outcome{res, rejected}
+			case <-d.done:
+				return
+			}
+		}
+	}()
+
+	return d
+}
+
+func TestReplayFire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal"))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	records := [][]string{
+		{"tr", "savings", "", "2020-01-01", "1000"},
+		{"ev", "rent", "", "2020-01-05", "3", "0,1,0", "-500"},
+		{"fire", "0", "2020-01-05T00:00:00Z"},
+	}
+	for i, r := range records {
+		if err = j.Append(r); err != nil {
+			t.Fatalf("%d: append: %s", i, err)
+		}
+	}
+	j.Close()
+
+	// the fire record leaves the event where it was when it was written
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	if n := len(d.ledger.Transactions()); n != 2 {
+		t.Fatalf("got %d transactions", n)
+	}
+	ev, _ := d.ledger.Event(0)
+	if ev.Times != 2 || !ev.Date.Equal(time.Date(2020, 2, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("event is %+v", ev)
+	}
+
+	fired, err := d.catchUp()
+	if err != nil || len(fired) != 0 {
+		t.Errorf("nothing to catch up, got %v: %v", fired, err)
+	}
+
+	// what was missed is fired and journaled once
+	d = testDaemon(t, dir, time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC))
+	if fired, err = d.catchUp(); err != nil || len(fired) != 2 {
+		t.Fatalf("got %v: %v", fired, err)
+	}
+
+	d = testDaemon(t, dir, time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC))
+	if fired, err = d.catchUp(); err != nil || len(fired) != 0 {
+		t.Errorf("fired again %v: %v", fired, err)
+	}
+	if n := len(d.ledger.Transactions()); n != 4 {
+		t.Errorf("got %d transactions", n)
+	}
+	if ev, _ = d.ledger.Event(0); ev.Times != 0 {
+		t.Errorf("event is %+v", ev)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Now())
+	write := func(f *os.File) error {
+		_, err := f.WriteString("answer")
+		return err
+	}
+
+	if err = d.answer("march", write); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "march")); err != nil || string(b) != "answer" {
+		t.Errorf("got %q: %v", b, err)
+	}
+
+	d.cfg.CtlFilePath = filepath.Join(dir, "ctl")
+	d.cfg.RatesPath = filepath.Join(dir, "rates")
+	d.cfg.SocketPath = filepath.Join(dir, "sock")
+
+	// the files of the daemon sit next to the reply file
+	refused := []string{
+		filepath.Join(dir, "abs"), "../up", "sub/file", `sub\file`, ".", "..",
+		"journal", "journal.ctl", "status", "ctl", "rates", "sock", "reply",
+	}
+	for _, out := range refused {
+		if err = d.answer(out, write); err == nil {
+			t.Errorf("%q should have been refused", out)
+		}
+	}
+	if b, err := ioutil.ReadFile(d.cfg.StatusPath); err != nil || len(b) != 0 {
+		t.Errorf("status file is %q: %v", b, err)
+	}
+
+	// nor under another name
+	if err = os.Link(d.cfg.JournalPath, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.answer("link", write); err == nil {
+		t.Errorf("a link to the journal should have been refused")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	d.cfg.SocketPath = filepath.Join(dir, "sock")
+	if err = d.listenSocket(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.ledger.Exec([]string{"tr", "market", "", "2020-01-10", "-30"}); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(path string) error {
+		c := &client{cfg: &config.Config{SocketPath: path, Timeout: 5 * time.Second}}
+		_, err := c.send([]string{"tr", "payroll", "", "2020-01-01", "1000"})
+		return err
+	}
+
+	moved := func(files, sock string) *config.Config {
+		cfg := *d.cfg
+		cfg.StatusPath = filepath.Join(dir, files, "status")
+		cfg.ReplyPath = filepath.Join(dir, files, "reply")
+		cfg.SocketPath = filepath.Join(dir, sock, "sock")
+		return &cfg
+	}
+
+	if err = os.Mkdir(filepath.Join(dir, "new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files open but the socket can't, nothing changes
+	old := d.cfg
+	if err = d.reconfigure(moved("new", "missing")); err == nil {
+		t.Fatal("should have failed")
+	}
+	if d.cfg != old || d.status.Name() != old.StatusPath || d.reply.Name() != old.ReplyPath {
+		t.Errorf("got %+v", d.cfg)
+	}
+	if err = send(old.SocketPath); err != nil {
+		t.Errorf("the old socket should be open: %s", err)
+	}
+
+	cfg := moved("new", "new")
+	if err = d.reconfigure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if d.cfg != cfg || d.status.Name() != cfg.StatusPath || d.reply.Name() != cfg.ReplyPath {
+		t.Errorf("got %+v", d.cfg)
+	}
+
+	// the state moves along
+	var s stats.Stats
+	if b, err := ioutil.ReadFile(cfg.StatusPath); err != nil || json.Unmarshal(b, &s) != nil || s.Treasury.Total != amount("970") {
+		t.Errorf("got %q: %v", b, err)
+	}
+
+	if err = send(old.SocketPath); err == nil {
+		t.Errorf("the old socket should be closed")
+	}
+	if err = send(cfg.SocketPath); err != nil {
+		t.Errorf("the new socket should be open: %s", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/exporter"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+/*
+* export  ledger
+* export  ics
+ */
+func (c *client) exportFile(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("export: missing format")
+	}
+	if args[0] != "ledger" && args[0] != "ics" {
+		return fmt.Errorf("export: %s is not a format", args[0])
+	}
+
+	var events []stats.Event
+	if err := c.get("/events", &events); err != nil {
+		return err
+	}
+
+	if args[0] == "ics" {
+		return exporter.ICS(os.Stdout, events, time.Now())
+	}
+
+	var transactions []stats.Transaction
+	if err := c.get("/transactions", &transactions); err != nil {
+		return err
+	}
+
+	return exporter.Ledger(os.Stdout, transactions, events, c.cfg.Currency)
+}
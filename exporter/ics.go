@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// ICS writes an iCalendar with an all-day VEVENT for every event that still
+// fires, repeating by an RRULE made from its step and times. The summary
+// has the name and the amount so bills and paydays can be told apart at a
+// glance. now is the time the calendar is made at.
+func ICS(out io.Writer, events []stats.Event, now time.Time) error {
+	w := bufio.NewWriter(out)
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	line(w, "BEGIN:VCALENDAR")
+	line(w, "VERSION:2.0")
+	line(w, "PRODID:-//DomesticAdvisor//EN")
+	line(w, "CALSCALE:GREGORIAN")
+
+	for _, ev := range events {
+		if ev.Times == 0 || ev.State != stats.Active {
+			continue
+		}
+
+		summary := ev.Name + " " + ev.Amount.String()
+		if ev.Currency != "" {
+			summary += " " + ev.Currency
+		}
+
+		line(w, "BEGIN:VEVENT")
+		line(w, fmt.Sprintf("UID:event-%d@domestic-advisor", ev.Id))
+		line(w, "DTSTAMP:"+stamp)
+		line(w, "DTSTART;VALUE=DATE:"+ev.Date.Format("20060102"))
+		line(w, "SUMMARY:"+escape(summary))
+		if ev.Description != "" {
+			line(w, "DESCRIPTION:"+escape(ev.Description))
+		}
+		if ev.Category != "" {
+			line(w, "CATEGORIES:"+escape(ev.Category))
+		}
+		if rule := rrule(ev); rule != "" {
+			line(w, "RRULE:"+rule)
+		}
+		line(w, "END:VEVENT")
+	}
+
+	line(w, "END:VCALENDAR")
+
+	return w.Flush()
+}
+
+// rrule returns the recurrence of the occurrences left of the event, an
+// empty one if it happens once or its step mixes days with months
+func rrule(ev stats.Event) string {
+	if ev.Step == [3]int{} || ev.Times == 1 {
+		return ""
+	}
+
+	var rule string
+
+	switch y, m, d := ev.Step[0], ev.Step[1], ev.Step[2]; {
+	case d == 0 && m == 0:
+		rule = fmt.Sprintf("FREQ=YEARLY;INTERVAL=%d", y)
+	case d == 0:
+		rule = fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d", 12*y+m)
+	case y == 0 && m == 0 && d%7 == 0:
+		rule = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d", d/7)
+	case y == 0 && m == 0:
+		rule = fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", d)
+	default:
+		return ""
+	}
+
+	if ev.Times > 0 {
+		rule += fmt.Sprintf(";COUNT=%d", ev.Times)
+	}
+
+	return rule
+}
+
+// line writes a content line folded at 75 octets as RFC 5545 asks, without
+// splitting a character
+func line(w *bufio.Writer, s string) {
+	for limit := 75; len(s) > limit; limit = 74 {
+		i := limit
+		for i > 0 && s[i]&0xc0 == 0x80 {
+			i--
+		}
+		w.WriteString(s[:i] + "\r\n ")
+		s = s[i:]
+	}
+	w.WriteString(s + "\r\n")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace(s)
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+func TestICS(t *testing.T) {
+	evs := []stats.Event{
+		{Id: 1, Name: "rent", Description: "flat, 2nd floor; north", Date: date(2020, 2, 1), Times: 12, Step: [3]int{0, 1, 0}, Amount: amount("-500"), Attrs: stats.Attrs{Category: "housing"}},
+		{Id: 2, Name: "salary", Date: date(2020, 1, 3), Times: -1, Step: [3]int{0, 0, 14}, Amount: amount("1500"), Attrs: stats.Attrs{Currency: "EUR"}},
+		{Id: 3, Name: "bonus", Date: date(2020, 6, 1), Times: 1, Amount: amount("100")},
+		{Id: 4, Name: "insurance", Date: date(2020, 1, 1), Times: 2, Step: [3]int{1, 6, 0}, Amount: amount("-1")},
+		{Id: 5, Name: "paused", Date: date(2020, 1, 1), Times: 2, Step: [3]int{0, 1, 0}, Amount: amount("-1"), State: stats.Paused},
+		{Id: 6, Name: "done", Date: date(2020, 1, 1), Times: 0, Amount: amount("-1")},
+	}
+
+	calendar := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//DomesticAdvisor//EN",
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VEVENT",
+		"UID:event-1@domestic-advisor",
+		"DTSTAMP:20200101T120000Z",
+		"DTSTART;VALUE=DATE:20200201",
+		"SUMMARY:rent -500.00",
+		`DESCRIPTION:flat\, 2nd floor\; north`,
+		"CATEGORIES:housing",
+		"RRULE:FREQ=MONTHLY;INTERVAL=1;COUNT=12",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:event-2@domestic-advisor",
+		"DTSTAMP:20200101T120000Z",
+		"DTSTART;VALUE=DATE:20200103",
+		"SUMMARY:salary 1500.00 EUR",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:event-3@domestic-advisor",
+		"DTSTAMP:20200101T120000Z",
+		"DTSTART;VALUE=DATE:20200601",
+		"SUMMARY:bonus 100.00",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:event-4@domestic-advisor",
+		"DTSTAMP:20200101T120000Z",
+		"DTSTART;VALUE=DATE:20200101",
+		"SUMMARY:insurance -1.00",
+		"RRULE:FREQ=MONTHLY;INTERVAL=18;COUNT=2",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}
+
+	var b strings.Builder
+	if err := ICS(&b, evs, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := strings.Join(calendar, "\r\n"); b.String() != want {
+		t.Errorf("got\n%s\nand should be\n%s", b.String(), want)
+	}
+}
+
+func TestICSFold(t *testing.T) {
+	name := strings.Repeat("ñ", 60)
+
+	var b strings.Builder
+	ICS(&b, []stats.Event{{Name: name, Date: date(2020, 1, 1), Times: 1}}, time.Now())
+
+	var summary string
+	for _, l := range strings.Split(b.String(), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line of %d octets", len(l))
+		}
+
+		switch {
+		case strings.HasPrefix(l, "SUMMARY:"):
+			summary = l
+		case strings.HasPrefix(l, " ") && summary != "":
+			summary += l[1:]
+		default:
+			if summary != "" && summary != "SUMMARY:"+name+" 0.00" {
+				t.Errorf("got %q once unfolded", summary)
+			}
+			summary = ""
+		}
+	}
+}
+
+func TestICSProcessEvent(t *testing.T) {
+	ev, err := stats.ProcessEvent([]string{"ev", "rent", "", "2020-02-01", "-1", "0,1,0", "-500"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err = ICS(&b, []stats.Event{ev}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// an event that repeats forever has no count
+	if !strings.Contains(b.String(), "\r\nRRULE:FREQ=MONTHLY;INTERVAL=1\r\n") {
+		t.Errorf("got\n%s", b.String())
+	}
+}
@@ -0,0 +1,137 @@
+// Package exporter writes the state of the daemon in the formats other
+// programs read.
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// Ledger writes a journal that ledger and hledger can read. Every
+// transaction moves its amount between assets (the account it is tied to)
+// and income or expenses (its category). Events that still fire are
+// written as periodic transactions starting at their next occurrence, base
+// is the commodity of the amounts without a currency.
+func Ledger(out io.Writer, transactions []stats.Transaction, events []stats.Event, base string) error {
+	w := bufio.NewWriter(out)
+
+	for _, tr := range transactions {
+		header := tr.Date.Format("2006-01-02")
+		if tr.Ref != "" {
+			header += " (" + clean(tr.Ref) + ")"
+		}
+		header += " " + clean(tr.Name)
+
+		postings(w, header, tr.Description, tr.Amount, tr.Attrs, base)
+	}
+
+	for _, ev := range events {
+		if ev.Times == 0 || ev.State != stats.Active {
+			continue
+		}
+
+		period, err := period(ev)
+		if err != nil {
+			fmt.Fprintf(w, "; event %d: %s\n\n", ev.Id, err)
+			continue
+		}
+
+		// hledger wants two spaces between the period and the description
+		postings(w, "~ "+period+"  "+clean(ev.Name), ev.Description, ev.Amount, ev.Attrs, base)
+	}
+
+	return w.Flush()
+}
+
+func postings(w io.Writer, header, description string, amount stats.Amount, attrs stats.Attrs, base string) {
+	if description != "" {
+		header += "  ; " + clean(description)
+	}
+	fmt.Fprintln(w, header)
+
+	if len(attrs.Tags) > 0 {
+		fmt.Fprintf(w, "    ; :%s:\n", strings.Join(attrs.Tags, ":"))
+	}
+
+	assets := "assets"
+	if attrs.Account != "" {
+		assets += ":" + attrs.Account
+	}
+
+	other := "expenses"
+	if amount > 0 {
+		other = "income"
+	}
+	if attrs.Category != "" {
+		other += ":" + attrs.Category
+	}
+
+	commodity := attrs.Currency
+	if commodity == "" {
+		commodity = base
+	}
+	if commodity != "" {
+		commodity = " " + commodity
+	}
+
+	width := len(assets)
+	if len(other) > width {
+		width = len(other)
+	}
+
+	fmt.Fprintf(w, "    %-*s  %s%s\n", width, other, -amount, commodity)
+	fmt.Fprintf(w, "    %s\n\n", assets)
+}
+
+// period returns the period expression of the occurrences left of the
+// event. The end is exclusive so it's the day after the last one.
+func period(ev stats.Event) (string, error) {
+	from := ev.Date.Format("2006-01-02")
+
+	// an event that can't repeat happens once
+	if ev.Step == [3]int{} || ev.Times == 1 {
+		return fmt.Sprintf("every day from %s to %s", from, ev.Date.AddDate(0, 0, 1).Format("2006-01-02")), nil
+	}
+
+	var n int
+	var unit string
+
+	switch y, m, d := ev.Step[0], ev.Step[1], ev.Step[2]; {
+	case d == 0:
+		n, unit = 12*y+m, "month"
+		if m == 0 {
+			n, unit = y, "year"
+		}
+	case y == 0 && m == 0 && d%7 == 0:
+		n, unit = d/7, "week"
+	case y == 0 && m == 0:
+		n, unit = d, "day"
+	default:
+		return "", fmt.Errorf("a step of %d,%d,%d has no period", y, m, d)
+	}
+
+	every := "every " + unit
+	if n > 1 {
+		every = fmt.Sprintf("every %d %ss", n, unit)
+	}
+
+	if ev.Times < 0 {
+		return every + " from " + from, nil
+	}
+
+	last := ev.Date
+	for i := 1; i < ev.Times; i++ {
+		last = last.AddDate(ev.Step[0], ev.Step[1], ev.Step[2])
+	}
+
+	return every + " from " + from + " to " + last.AddDate(0, 0, 1).Format("2006-01-02"), nil
+}
+
+// clean keeps text that comes from commands on a single line
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func amount(s string) stats.Amount {
+	a, err := stats.ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func TestLedger(t *testing.T) {
+	trs := []stats.Transaction{
+		{Id: 1, Name: "market", Description: "weekly shop", Date: date(2020, 1, 4), Amount: amount("-52.3"), Attrs: stats.Attrs{Account: "cash", Category: "food", Tags: []string{"a", "b"}}},
+		{Id: 2, Name: "payroll", Date: date(2020, 1, 15), Amount: amount("1500"), Attrs: stats.Attrs{Currency: "EUR", Ref: "2020011501"}},
+	}
+	evs := []stats.Event{
+		{Id: 1, Name: "rent", Date: date(2020, 2, 1), Times: 3, Step: [3]int{0, 1, 0}, Amount: amount("-500"), Attrs: stats.Attrs{Category: "housing"}},
+		{Id: 2, Name: "cleaning", Date: date(2020, 1, 3), Times: -1, Step: [3]int{0, 0, 14}, Amount: amount("-20")},
+		{Id: 3, Name: "bonus", Date: date(2020, 6, 1), Times: 1, Amount: amount("100")},
+		{Id: 4, Name: "odd", Date: date(2020, 1, 1), Times: 2, Step: [3]int{0, 1, 1}, Amount: amount("-1")},
+		{Id: 5, Name: "paused", Date: date(2020, 1, 1), Times: 2, Step: [3]int{0, 1, 0}, Amount: amount("-1"), State: stats.Paused},
+		{Id: 6, Name: "done", Date: date(2020, 1, 1), Times: 0, Amount: amount("-1")},
+	}
+
+	journal := `2020-01-04 market  ; weekly shop
+    ; :a:b:
+    expenses:food  52.30 USD
+    assets:cash
+
+2020-01-15 (2020011501) payroll
+    income  -1500.00 EUR
+    assets
+
+~ every month from 2020-02-01 to 2020-04-02  rent
+    expenses:housing  500.00 USD
+    assets
+
+~ every 2 weeks from 2020-01-03  cleaning
+    expenses  20.00 USD
+    assets
+
+~ every day from 2020-06-01 to 2020-06-02  bonus
+    income  -100.00 USD
+    assets
+
+; event 4: a step of 0,1,1 has no period
+
+`
+
+	var b strings.Builder
+	if err := Ledger(&b, trs, evs, "USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != journal {
+		t.Errorf("got\n%s\nand should be\n%s", b.String(), journal)
+	}
+}
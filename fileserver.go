@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/argot42/DomesticAdvisor/exporter"
+	"github.com/argot42/DomesticAdvisor/ninep"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// listen9P serves the file tree on the 9P address of the configuration,
+// closing the listener that was open before
+func (d *daemon) listen9P() error {
+	l, err := open9P(d.cfg.NinePAddr)
+	if err != nil {
+		return err
+	}
+
+	d.serve9P(l)
+	return nil
+}
+
+// open9P listens on the dial string, there is no listener if it's empty
+func open9P(dial string) (net.Listener, error) {
+	if dial == "" {
+		return nil, nil
+	}
+
+	l, err := ninep.Listen(dial)
+	if err != nil {
+		return nil, fmt.Errorf("9p: %s", err)
+	}
+
+	return l, nil
+}
+
+// serve9P closes the listener that was open and serves the file tree on l
+func (d *daemon) serve9P(l net.Listener) {
+	if d.ninep != nil {
+		d.ninep.Close()
+		d.ninep = nil
+	}
+
+	if l == nil {
+		return
+	}
+
+	owner := "none"
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+
+	srv := &ninep.Server{Root: d.fileTree(), User: owner}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Printf("9p: %s\n", err)
+		}
+	}()
+
+	d.ninep = l
+	log.Println("serving 9p on", l.Addr())
+}
+
+/*
+* /ctl                   commands, one per line
+* /status                the status file
+* /transactions/<id>     a transaction
+* /events/<id>           an event
+* /months/<yyyy-mm>      stats at the end of the month
+ */
+func (d *daemon) fileTree() *ninep.File {
+	dir := func(name string, list func() []*ninep.File) *ninep.File {
+		return &ninep.File{Name: name, List: list}
+	}
+
+	// every line of a write is a command, the write fails at the first one
+	// that is rejected. Nothing that writes files is taken.
+	ctl := &ninep.File{
+		Name: "ctl",
+		Write: func(data []byte) error {
+			for _, line := range bytes.Split(data, []byte{'\n'}) {
+				if len(bytes.TrimSpace(line)) == 0 {
+					continue
+				}
+
+				parsed, err := stats.Parse(bytes.NewReader(line))
+				if err != nil {
+					return fmt.Errorf("parsing: %s", err)
+				}
+				if err = remoteCommand(parsed); err != nil {
+					return err
+				}
+
+				if _, err = d.submit(parsed); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	status := &ninep.File{
+		Name: "status",
+		Read: func() ([]byte, error) {
+			return marshal(d.ledger.Stats())
+		},
+	}
+
+	transactions := dir("transactions", func() []*ninep.File {
+		var files []*ninep.File
+		for _, tr := range d.ledger.Transactions() {
+			id := tr.Id
+			files = append(files, &ninep.File{
+				Name: strconv.FormatUint(uint64(id), 10),
+				Read: func() ([]byte, error) {
+					tr, ok := d.ledger.Transaction(id)
+					if !ok {
+						return nil, fmt.Errorf("The transaction with id %d does not exist", id)
+					}
+					return marshal(tr)
+				},
+			})
+		}
+		return files
+	})
+
+	events := dir("events", func() []*ninep.File {
+		var files []*ninep.File
+		for _, ev := range d.ledger.Events() {
+			id := ev.Id
+			files = append(files, &ninep.File{
+				Name: strconv.FormatUint(uint64(id), 10),
+				Read: func() ([]byte, error) {
+					ev, ok := d.ledger.Event(id)
+					if !ok {
+						return nil, fmt.Errorf("The event with id %d does not exist", id)
+					}
+					return marshal(ev)
+				},
+			})
+		}
+		return files
+	})
+
+	calendar := &ninep.File{
+		Name: "calendar.ics",
+		Read: func() ([]byte, error) {
+			var b bytes.Buffer
+			err := exporter.ICS(&b, d.ledger.Events(), d.clock.Now())
+			return b.Bytes(), err
+		},
+	}
+
+	forecast := &ninep.File{
+		Name: "forecast",
+		Read: func() ([]byte, error) {
+			q, _ := stats.ProcessForecastQuery([]string{"fc"})
+			return marshal(d.ledger.Forecast(q))
+		},
+	}
+
+	months := dir("months", func() []*ninep.File {
+		var files []*ninep.File
+		for _, month := range d.ledger.Months() {
+			month := month
+			files = append(files, &ninep.File{
+				Name: month.Format("2006-01"),
+				Read: func() ([]byte, error) {
+					return marshal(d.ledger.Period(stats.MonthPeriod(month)))
+				},
+			})
+		}
+		return files
+	})
+
+	return dir("/", func() []*ninep.File {
+		return []*ninep.File{ctl, status, transactions, events, calendar, forecast, months}
+	})
+}
+
+// remoteCommand refuses the commands that write files, those that come
+// over the network can only change the ledger. What q, st and fc
+// answer is in the api and the file tree already.
+func remoteCommand(parsed []string) error {
+	switch parsed[0] {
+	case "q", "st", "fc":
+		return fmt.Errorf("%s is only taken from the control file", parsed[0])
+	}
+
+	for _, arg := range parsed[1:] {
+		if strings.HasPrefix(arg, "out=") {
+			return fmt.Errorf("out= is only taken from the control file")
+		}
+	}
+
+	return nil
+}
+
+// marshal encodes what a file shows, ending in a newline like any text file
+func marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/ninep"
+)
+
+func TestCtlFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileserver_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	var ctl *ninep.File
+	for _, f := range d.fileTree().List() {
+		if f.Name == "ctl" {
+			ctl = f
+		}
+	}
+	if ctl == nil {
+		t.Fatal("no ctl file")
+	}
+
+	if err = ctl.Write([]byte("tr market food 2020-01-10 -30\n\ntr payroll \"\" 2020-01-01 1000\n")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.ledger.Transactions()); n != 2 {
+		t.Errorf("got %d transactions", n)
+	}
+
+	bad := []string{
+		"tr foo bar 2020-13-01 200",
+		"q out=/etc/passwd",
+		"st",
+		"fc months=1",
+		"ac cash cash out=x",
+	}
+	for i, line := range bad {
+		if err = ctl.Write([]byte(line)); err == nil {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+	if n := len(d.ledger.Transactions()); n != 2 {
+		t.Errorf("got %d transactions", n)
+	}
+}
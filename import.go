@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/importer"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+/*
+* import  csv  <profile>  <file>
+* import  ofx  <file>     [acc=<account>] [cat=<category>]
+* import  ledger  <file>
+ */
+func (c *client) importFile(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("import: missing format")
+	}
+
+	var rows []importer.Row
+	var events []importer.EventRow
+	var accounts []stats.Account
+	var errs []error
+
+	switch args[0] {
+	case "csv":
+		if len(args) < 3 {
+			return fmt.Errorf("import: missing arguments")
+		}
+
+		p, ok := c.cfg.Profiles[args[1]]
+		if !ok {
+			return fmt.Errorf("import: there is no profile %s", args[1])
+		}
+
+		f, err := os.Open(args[2])
+		if err != nil {
+			return fmt.Errorf("import: %s", err)
+		}
+		defer f.Close()
+
+		rows, errs = importer.CSV(f, p)
+	case "ofx", "qfx":
+		if len(args) < 2 {
+			return fmt.Errorf("import: missing arguments")
+		}
+
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("import: %s", err)
+		}
+		defer f.Close()
+
+		rows, errs = importer.OFX(f, c.cfg.Currency)
+
+		// statements don't say which of our accounts they belong to
+		for _, arg := range args[2:] {
+			kv := strings.SplitN(arg, "=", 2)
+			if len(kv) != 2 || (kv[0] != "acc" && kv[0] != "cat") {
+				return fmt.Errorf("import: %q should be acc=<account> or cat=<category>", arg)
+			}
+
+			for i := range rows {
+				if kv[0] == "acc" {
+					rows[i].Transaction.Account = kv[1]
+				} else {
+					rows[i].Transaction.Category = kv[1]
+				}
+			}
+		}
+	case "ledger":
+		if len(args) < 2 {
+			return fmt.Errorf("import: missing arguments")
+		}
+
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("import: %s", err)
+		}
+		defer f.Close()
+
+		rows, events, accounts, errs = importer.Ledger(f, c.cfg.Currency, time.Now())
+	default:
+		return fmt.Errorf("import: %s is not a format", args[0])
+	}
+
+	// every row goes through the daemon like any other command
+	type record struct {
+		line   int
+		fields []string
+	}
+
+	var records []record
+	for _, row := range rows {
+		records = append(records, record{row.Line, stats.TransactionRecord(row.Transaction)})
+	}
+	for _, row := range events {
+		records = append(records, record{row.Line, stats.EventRecord(row.Event)})
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].line < records[j].line
+	})
+
+	// the accounts of a journal are declared before the rows tied to them,
+	// those the daemon has already are left as they are
+	declared := 0
+	for _, ac := range accounts {
+		_, err := c.send([]string{"ac", ac.Name, ac.Kind})
+		if err != nil && strings.HasPrefix(err.Error(), stats.ErrAccountExists.Error()) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("import: account %s: %s", ac.Name, err)
+		}
+		declared++
+	}
+
+	imported := map[string]int{}
+	duplicates := 0
+	for _, r := range records {
+		_, err := c.send(r.fields)
+
+		// the daemon answers with text, the error can't be compared
+		if err != nil && strings.HasPrefix(err.Error(), stats.ErrDuplicate.Error()) {
+			duplicates++
+			continue
+		}
+		if err != nil {
+			errs = append(errs, importer.RowError{Line: r.line, Err: err})
+			continue
+		}
+		imported[r.fields[0]]++
+	}
+
+	// errors of the file and of the daemon in the order of the lines
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, aok := errs[i].(importer.RowError)
+		b, bok := errs[j].(importer.RowError)
+		return aok && bok && a.Line < b.Line
+	})
+
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if declared > 0 {
+		fmt.Printf("declared %d accounts\n", declared)
+	}
+	fmt.Printf("imported %d transactions\n", imported["tr"])
+	if imported["ev"] > 0 {
+		fmt.Printf("imported %d events\n", imported["ev"])
+	}
+	if duplicates > 0 {
+		fmt.Printf("skipped %d already imported\n", duplicates)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d lines failed", len(errs))
+	}
+
+	return nil
+}
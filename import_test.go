@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+const importJournal = `2020-01-10 market
+    expenses:food  $10
+    assets:bank:checking
+
+2020-01-12 fuel
+    expenses:car  20 USD
+    liabilities:visa
+`
+
+// a journal with accounts the daemon doesn't have is imported whole, and
+// so is what the daemon exports into another one
+func TestImportLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	client := func(name string) (*daemon, *config.Config) {
+		sub := filepath.Join(dir, name)
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		d := testDaemon(t, sub, now)
+		srv := httptest.NewServer(d.api())
+		t.Cleanup(srv.Close)
+
+		return d, &config.Config{HTTPAddr: strings.TrimPrefix(srv.URL, "http://"), Timeout: 5 * time.Second, Currency: "USD"}
+	}
+
+	path := filepath.Join(dir, "journal")
+	if err = ioutil.WriteFile(path, []byte(importJournal), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, cfg := client("a")
+	out, err := stdout(t, cfg, "import", "ledger", path)
+	if err != nil {
+		t.Fatalf("%s: %s", out, err)
+	}
+	if !strings.Contains(out, "declared 2 accounts") || !strings.Contains(out, "imported 2 transactions") {
+		t.Errorf("got\n%s", out)
+	}
+
+	accounts := func(d *daemon) (names []string) {
+		for _, tr := range d.ledger.Transactions() {
+			names = append(names, tr.Account)
+		}
+		return
+	}
+	if got := accounts(a); !reflect.DeepEqual(got, []string{"bank:checking", "visa"}) {
+		t.Errorf("got accounts %v", got)
+	}
+
+	// declared accounts are left as they are
+	if err = ioutil.WriteFile(path, []byte(importJournal[:strings.Index(importJournal, "\n\n")+1]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err = stdout(t, cfg, "import", "ledger", path); err != nil || strings.Contains(out, "declared") {
+		t.Errorf("got\n%s: %v", out, err)
+	}
+
+	exported, err := output(t, cfg, "export", "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, []byte(exported), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, cfg := client("b")
+	if out, err = stdout(t, cfg, "import", "ledger", path); err != nil {
+		t.Fatalf("%s\n%s: %s", exported, out, err)
+	}
+
+	strip := func(trs []stats.Transaction) []stats.Transaction {
+		for i := range trs {
+			trs[i].Id = 0
+		}
+		return trs
+	}
+	if ta, tb := strip(a.ledger.Transactions()), strip(b.ledger.Transactions()); !reflect.DeepEqual(ta, tb) {
+		t.Errorf("got %+v and should be %+v", tb, ta)
+	}
+}
@@ -0,0 +1,173 @@
+// Package importer turns bank statements into transactions.
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// Row is a transaction read from a statement and where it came from
+type Row struct {
+	Line        int
+	Transaction stats.Transaction
+}
+
+// RowError tells why a line of a statement couldn't be imported
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// CSV reads a statement with the columns the profile says, the rows that
+// can't be read are returned as RowErrors and the rest are still imported
+func CSV(in io.Reader, p *config.Profile) (rows []Row, errs []error) {
+	r := csv.NewReader(in)
+	r.Comma = p.Comma
+	r.FieldsPerRecord = -1
+	// banks like to pad their columns
+	r.TrimLeadingSpace = true
+	r.LazyQuotes = true
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			// the reader goes on with the next line after a parse error
+			if e, ok := err.(*csv.ParseError); ok {
+				errs = append(errs, RowError{e.StartLine, e.Err})
+				continue
+			}
+			errs = append(errs, err)
+			break
+		}
+
+		line, _ := r.FieldPos(0)
+
+		if line <= p.Skip {
+			continue
+		}
+
+		// blank lines at the end of the file
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		tr, err := row(record, p)
+		if err != nil {
+			errs = append(errs, RowError{line, err})
+			continue
+		}
+
+		rows = append(rows, Row{line, tr})
+	}
+
+	return
+}
+
+func row(record []string, p *config.Profile) (stats.Transaction, error) {
+	field := func(n int) (string, error) {
+		if n == 0 {
+			return "", nil
+		}
+		if n > len(record) {
+			return "", fmt.Errorf("missing column %d", n)
+		}
+		return strings.TrimSpace(record[n-1]), nil
+	}
+
+	value, err := field(p.Date)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+	date, err := time.Parse(p.DateFormat, value)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+
+	payee, err := field(p.Payee)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+	description, err := field(p.Description)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+
+	// the payee is the name, without one the description takes its place
+	name := payee
+	if name == "" {
+		name, description = description, ""
+	}
+	if name == "" {
+		return stats.Transaction{}, fmt.Errorf("no payee or description")
+	}
+
+	var amount stats.Amount
+
+	if p.Amount != 0 {
+		if value, err = field(p.Amount); err != nil {
+			return stats.Transaction{}, err
+		}
+		if amount, err = parseAmount(value, p); err != nil {
+			return stats.Transaction{}, err
+		}
+	} else {
+		// money going out is written as a positive debit
+		debit, credit := stats.Amount(0), stats.Amount(0)
+
+		if value, err = field(p.Debit); err != nil {
+			return stats.Transaction{}, err
+		}
+		if value != "" {
+			if debit, err = parseAmount(value, p); err != nil {
+				return stats.Transaction{}, err
+			}
+		}
+
+		if value, err = field(p.Credit); err != nil {
+			return stats.Transaction{}, err
+		}
+		if value != "" {
+			if credit, err = parseAmount(value, p); err != nil {
+				return stats.Transaction{}, err
+			}
+		}
+
+		if debit < 0 {
+			debit = -debit
+		}
+		amount = credit - debit
+	}
+
+	attrs := stats.Attrs{Currency: p.Currency, Account: p.Account, Category: p.Category}
+
+	return stats.BuildTransaction(name, description, date, amount, attrs), nil
+}
+
+// parseAmount reads an amount written with the separators of the profile
+func parseAmount(s string, p *config.Profile) (stats.Amount, error) {
+	if p.Thousands != 0 {
+		s = strings.ReplaceAll(s, string(p.Thousands), "")
+	}
+	if p.Decimal != '.' {
+		if strings.IndexByte(s, '.') >= 0 {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		s = strings.ReplaceAll(s, string(p.Decimal), ".")
+	}
+
+	return stats.ParseAmount(s)
+}
@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/config"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+func amount(s string) stats.Amount {
+	a, err := stats.ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func TestCSV(t *testing.T) {
+	in := `Fecha;Concepto;Detalle;Debe;Haber
+01/02/2020;Supermarket;card 1234;1.052,30;
+02/02/2020; Salary ;;;2.000,00
+03/02/2020;Refund;;-5,00;
+30/02/2020;Bad date;;1,00;
+04/02/2020;;;1,00;
+05/02/2020;Bad amount;;1,00,0;
+06/02/2020;Short
+
+`
+	p := &config.Profile{
+		Comma:       ';',
+		Skip:        1,
+		Date:        1,
+		DateFormat:  "02/01/2006",
+		Payee:       2,
+		Description: 3,
+		Debit:       4,
+		Credit:      5,
+		Decimal:     ',',
+		Thousands:   '.',
+		Account:     "checking",
+	}
+
+	rows, errs := CSV(strings.NewReader(in), p)
+
+	expected := []struct {
+		Line        int
+		Name        string
+		Description string
+		Date        time.Time
+		Amount      stats.Amount
+	}{
+		{2, "Supermarket", "card 1234", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), amount("-1052.30")},
+		{3, "Salary", "", time.Date(2020, 2, 2, 0, 0, 0, 0, time.UTC), amount("2000")},
+		{4, "Refund", "", time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC), amount("-5")},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("got %d rows and should be %d", len(rows), len(expected))
+	}
+	for i, exp := range expected {
+		line, tr := rows[i].Line, rows[i].Transaction
+		if line != exp.Line || tr.Name != exp.Name || tr.Description != exp.Description || !tr.Date.Equal(exp.Date) || tr.Amount != exp.Amount {
+			t.Errorf("%d: got %d %+v and should be %+v", i, line, tr, exp)
+		}
+		if tr.Account != "checking" {
+			t.Errorf("%d: got account %s", i, tr.Account)
+		}
+	}
+
+	lines := []int{5, 6, 7, 8}
+	if len(errs) != len(lines) {
+		t.Fatalf("got errors %v", errs)
+	}
+	for i, err := range errs {
+		if e, ok := err.(RowError); !ok || e.Line != lines[i] {
+			t.Errorf("%d: got %v and should be at line %d", i, err, lines[i])
+		}
+	}
+}
+
+func TestCSVAmountColumn(t *testing.T) {
+	in := "2020-01-01,coffee,-3.5\n2020-01-02,,\"4\"\n"
+	p := &config.Profile{Comma: ',', Date: 1, DateFormat: "2006-01-02", Description: 2, Amount: 3, Decimal: '.', Currency: "USD"}
+
+	rows, errs := CSV(strings.NewReader(in), p)
+	if len(rows) != 1 || len(errs) != 1 {
+		t.Fatalf("got %v %v", rows, errs)
+	}
+
+	tr := rows[0].Transaction
+	if tr.Name != "coffee" || tr.Amount != amount("-3.5") || tr.Currency != "USD" {
+		t.Errorf("got %+v", tr)
+	}
+}
@@ -0,0 +1,580 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// EventRow is an event read from a journal and where it came from
+type EventRow struct {
+	Line  int
+	Event stats.Event
+}
+
+// entry is a transaction or periodic transaction of a journal being read
+type entry struct {
+	line     int
+	periodic bool
+	header   string
+	postings []posting
+	tags     []string
+}
+
+type posting struct {
+	account   string
+	amount    stats.Amount
+	commodity string
+	elided    bool // the amount is whatever balances the entry
+}
+
+// Ledger reads the transactions of a ledger or hledger journal. The
+// posting to assets or liabilities is the money that comes in or goes out
+// and the account it's tied to, the other posting gives the category.
+// Periodic transactions are read as events, the occurrences before now are
+// expected to be in the journal already and are dropped. Amounts in the
+// base commodity are given no currency, $, €, £ and ¥ are taken for USD,
+// EUR, GBP and JPY. The accounts the rows and events are tied to are
+// returned in the order they first show up, so they can be declared.
+func Ledger(in io.Reader, base string, now time.Time) (rows []Row, events []EventRow, accounts []stats.Account, errs []error) {
+	var e *entry
+	skipping := "" // the end of a block comment
+
+	seen := map[string]bool{}
+	declare := func(e *entry) {
+		ac, ok := account(e)
+		if ok && !seen[ac.Name] {
+			seen[ac.Name] = true
+			accounts = append(accounts, ac)
+		}
+	}
+
+	finish := func() {
+		if e == nil {
+			return
+		}
+
+		if e.periodic {
+			ev, ok, err := ledgerEvent(e, base, now)
+			if err != nil {
+				errs = append(errs, RowError{e.line, err})
+			} else if ok {
+				events = append(events, EventRow{e.line, ev})
+				declare(e)
+			}
+		} else {
+			tr, err := ledgerTransaction(e, base)
+			if err != nil {
+				errs = append(errs, RowError{e.line, err})
+			} else {
+				rows = append(rows, Row{e.line, tr})
+				declare(e)
+			}
+		}
+		e = nil
+	}
+
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 1<<20)
+
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimRight(s.Text(), " \t\r")
+
+		if skipping != "" {
+			if text == skipping {
+				skipping = ""
+			}
+			continue
+		}
+
+		// postings and comments of the entry are indented
+		if text != "" && (text[0] == ' ' || text[0] == '\t') {
+			if e == nil {
+				continue
+			}
+
+			text = strings.TrimSpace(text)
+			if text == "" {
+				continue
+			}
+			if text[0] == ';' {
+				e.tags = append(e.tags, tags(text[1:])...)
+				continue
+			}
+
+			p, ok, err := parsePosting(text, e)
+			if err != nil {
+				errs = append(errs, RowError{line, err})
+				// the entry won't balance without it
+				e = nil
+			} else if ok {
+				e.postings = append(e.postings, p)
+			}
+			continue
+		}
+
+		finish()
+
+		switch {
+		case text == "":
+		case text[0] >= '0' && text[0] <= '9':
+			e = &entry{line: line, header: text}
+		case text[0] == '~':
+			e = &entry{line: line, periodic: true, header: strings.TrimSpace(text[1:])}
+		case text == "comment", text == "test":
+			skipping = "end " + text
+		case strings.HasPrefix(text, "include "):
+			errs = append(errs, RowError{line, fmt.Errorf("included files aren't read")})
+		}
+		// anything else is a comment or a directive like account or
+		// commodity that says nothing about the transactions
+	}
+	finish()
+
+	if err := s.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return
+}
+
+/*
+* <date>[=<date>] [*|!] [(<code>)] <payee>[ | <note>]  [; <comment>]
+* 2020-01-01 * (1234) market | weekly shop  ; :food:
+ */
+func ledgerTransaction(e *entry, base string) (stats.Transaction, error) {
+	header, comment := cut(e.header, ";")
+
+	first, rest := header, ""
+	if i := strings.IndexAny(header, " \t"); i >= 0 {
+		first, rest = header[:i], strings.TrimSpace(header[i:])
+	}
+
+	// the secondary date isn't kept
+	date, err := parseDate(strings.SplitN(first, "=", 2)[0])
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+
+	if strings.HasPrefix(rest, "*") || strings.HasPrefix(rest, "!") {
+		rest = strings.TrimSpace(rest[1:])
+	}
+
+	ref := ""
+	if strings.HasPrefix(rest, "(") {
+		if i := strings.IndexByte(rest, ')'); i > 0 {
+			ref, rest = rest[1:i], strings.TrimSpace(rest[i+1:])
+		}
+	}
+
+	// hledger splits the description in payee and note
+	name, description := cut(rest, "|")
+	if name == "" {
+		return stats.Transaction{}, fmt.Errorf("no payee")
+	}
+
+	e.tags = append(e.tags, tags(comment)...)
+	if description == "" && len(tags(comment)) == 0 {
+		description = comment
+	}
+
+	amount, attrs, err := balance(e, base)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+	attrs.Ref = ref
+
+	return stats.BuildTransaction(name, description, date, amount, attrs), nil
+}
+
+/*
+* ~ <period>  <description>  [; <comment>]
+* ~ every 2 weeks from 2020-01-03 to 2020-06-01  cleaning
+ */
+func ledgerEvent(e *entry, base string, now time.Time) (ev stats.Event, ok bool, err error) {
+	header, comment := cut(e.header, ";")
+
+	// two spaces end the period
+	period, name := header, ""
+	if i := strings.Index(header, "  "); i >= 0 {
+		period, name = header[:i], strings.TrimSpace(header[i:])
+	}
+	if name == "" {
+		name = "periodic"
+	}
+
+	description := ""
+	e.tags = append(e.tags, tags(comment)...)
+	if len(tags(comment)) == 0 {
+		description = comment
+	}
+
+	date, step, times, err := parsePeriod(period)
+	if err != nil {
+		return stats.Event{}, false, err
+	}
+
+	amount, attrs, err := balance(e, base)
+	if err != nil {
+		return stats.Event{}, false, err
+	}
+
+	ev = stats.BuildEvent(name, description, date, times, step, amount, attrs)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for ev.Times != 0 && ev.Date.Before(today) {
+		stats.Advance(&ev)
+	}
+
+	return ev, ev.Times != 0, nil
+}
+
+// parsePeriod reads the period expressions of periodic transactions that
+// have an interval and a start
+func parsePeriod(period string) (from time.Time, step [3]int, times int, err error) {
+	var to time.Time
+	words := strings.Fields(strings.ToLower(period))
+
+	next := func(i int) (string, error) {
+		if i+1 >= len(words) {
+			return "", fmt.Errorf("period %q ends after %s", period, words[i])
+		}
+		return words[i+1], nil
+	}
+
+	for i := 0; i < len(words); i++ {
+		var word string
+
+		switch w := words[i]; w {
+		case "every":
+			if word, err = next(i); err != nil {
+				return
+			}
+			i++
+
+			n := 1
+			if v, aerr := strconv.Atoi(word); aerr == nil {
+				if word, err = next(i); err != nil {
+					return
+				}
+				i++
+				n = v
+			}
+			if n < 1 {
+				err = fmt.Errorf("period %q repeats every %d", period, n)
+				return
+			}
+
+			if step, err = interval(strings.TrimSuffix(word, "s"), n); err != nil {
+				return
+			}
+		case "daily":
+			step, _ = interval("day", 1)
+		case "weekly":
+			step, _ = interval("week", 1)
+		case "biweekly", "fortnightly":
+			step, _ = interval("week", 2)
+		case "monthly":
+			step, _ = interval("month", 1)
+		case "bimonthly":
+			step, _ = interval("month", 2)
+		case "quarterly":
+			step, _ = interval("quarter", 1)
+		case "yearly", "annually":
+			step, _ = interval("year", 1)
+		case "from", "since", "to", "until":
+			if word, err = next(i); err != nil {
+				return
+			}
+			i++
+
+			var d time.Time
+			if d, err = parseDate(word); err != nil {
+				return
+			}
+			if w == "from" || w == "since" {
+				from = d
+			} else {
+				to = d
+			}
+		default:
+			err = fmt.Errorf("period %q can't be read", period)
+			return
+		}
+	}
+
+	if step == [3]int{} {
+		err = fmt.Errorf("period %q has no interval", period)
+		return
+	}
+	if from.IsZero() {
+		err = fmt.Errorf("period %q has no start", period)
+		return
+	}
+
+	if to.IsZero() {
+		return from, step, -1, nil
+	}
+
+	// the end isn't included
+	for d := from; d.Before(to); d = d.AddDate(step[0], step[1], step[2]) {
+		times++
+	}
+	if times == 0 {
+		err = fmt.Errorf("period %q ends before it starts", period)
+	}
+
+	return
+}
+
+func interval(unit string, n int) ([3]int, error) {
+	switch unit {
+	case "day":
+		return [3]int{0, 0, n}, nil
+	case "week":
+		return [3]int{0, 0, 7 * n}, nil
+	case "month":
+		return [3]int{0, n, 0}, nil
+	case "quarter":
+		return [3]int{0, 3 * n, 0}, nil
+	case "year":
+		return [3]int{n, 0, 0}, nil
+	}
+
+	return [3]int{}, fmt.Errorf("%s is not an interval", unit)
+}
+
+// parsePosting reads a posting, virtual postings in parentheses or
+// brackets aren't money moving and are left out
+func parsePosting(text string, e *entry) (p posting, ok bool, err error) {
+	text, comment := cut(text, ";")
+	e.tags = append(e.tags, tags(comment)...)
+
+	if strings.HasPrefix(text, "*") || strings.HasPrefix(text, "!") {
+		text = strings.TrimSpace(text[1:])
+	}
+	if strings.HasPrefix(text, "(") || strings.HasPrefix(text, "[") {
+		return posting{}, false, nil
+	}
+
+	// the account may have single spaces, the amount follows two or a tab
+	account, value := text, ""
+	if i := strings.IndexByte(text, '\t'); i >= 0 {
+		account, value = text[:i], text[i:]
+	}
+	if i := strings.Index(account, "  "); i >= 0 {
+		account, value = text[:i], text[i:]
+	}
+	p.account = strings.TrimSpace(account)
+
+	// prices and balance assertions don't change the amount
+	if i := strings.IndexAny(value, "@{="); i >= 0 {
+		value = value[:i]
+	}
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		p.elided = true
+		return p, true, nil
+	}
+
+	p.amount, p.commodity, err = parseLedgerAmount(value)
+	return p, err == nil, err
+}
+
+// parseLedgerAmount reads amounts like $-10.00, -$10, 10 USD or 1.000,50 EUR
+func parseLedgerAmount(s string) (stats.Amount, string, error) {
+	var number, commodity strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+			// commodities with digits or spaces are quoted
+			commodity.WriteRune(r)
+		case r >= '0' && r <= '9', r == '-', r == '+', r == '.', r == ',':
+			number.WriteRune(r)
+		case r == ' ':
+		default:
+			commodity.WriteRune(r)
+		}
+	}
+
+	value := strings.TrimPrefix(number.String(), "+")
+
+	// the last separator is the decimal one unless it groups thousands
+	dot, comma := strings.LastIndexByte(value, '.'), strings.LastIndexByte(value, ',')
+	switch {
+	case comma > dot && (dot >= 0 || len(value)-comma-1 != 3):
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	default:
+		value = strings.ReplaceAll(value, ",", "")
+	}
+
+	amount, err := stats.ParseAmount(value)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid amount %q", s)
+	}
+
+	return amount, commodity.String(), nil
+}
+
+// balance finds the amount of the entry from the money posting and the
+// attributes from the accounts
+func balance(e *entry, base string) (amount stats.Amount, attrs stats.Attrs, err error) {
+	var money *posting
+	var others []posting
+	var sum stats.Amount
+	elided := 0
+
+	for i, p := range e.postings {
+		if p.elided {
+			elided++
+		}
+
+		switch root, _ := cut(p.account, ":"); strings.ToLower(root) {
+		case "assets", "asset", "liabilities", "liability":
+			if money != nil {
+				return 0, attrs, fmt.Errorf("transfers between %s and %s aren't transactions", money.account, p.account)
+			}
+			money = &e.postings[i]
+		default:
+			others = append(others, p)
+			sum += p.amount
+		}
+	}
+
+	if money == nil {
+		return 0, attrs, fmt.Errorf("no assets or liabilities posting")
+	}
+	if elided > 1 {
+		return 0, attrs, fmt.Errorf("more than one posting without an amount")
+	}
+
+	amount, commodity := money.amount, money.commodity
+	if money.elided {
+		amount = -sum
+		commodity = ""
+		for _, p := range others {
+			if commodity != "" && p.commodity != commodity {
+				return 0, attrs, fmt.Errorf("postings in %s and %s", commodity, p.commodity)
+			}
+			commodity = p.commodity
+		}
+	}
+
+	if attrs.Currency, err = currency(commodity, base); err != nil {
+		return 0, attrs, err
+	}
+	_, attrs.Account = cut(money.account, ":")
+	if len(others) == 1 {
+		_, attrs.Category = cut(others[0].account, ":")
+	}
+	attrs.Tags = e.tags
+
+	return
+}
+
+// account returns the account the money posting of a balanced entry is
+// tied to. Accounts under liabilities are credit ones, those under assets
+// are checking ones unless the name ends in another kind, like
+// assets:bank:savings.
+func account(e *entry) (stats.Account, bool) {
+	for _, p := range e.postings {
+		root, name := cut(p.account, ":")
+		if name == "" {
+			continue
+		}
+
+		switch strings.ToLower(root) {
+		case "liabilities", "liability":
+			return stats.Account{Name: name, Kind: "credit"}, true
+		case "assets", "asset":
+			kind := "checking"
+			last := strings.ToLower(name[strings.LastIndex(name, ":")+1:])
+			for _, k := range stats.AccountKinds {
+				if last == k && k != "credit" {
+					kind = k
+				}
+			}
+			return stats.Account{Name: name, Kind: kind}, true
+		}
+	}
+
+	return stats.Account{}, false
+}
+
+// symbols of the currencies journals use the most, other commodities have
+// to be written with their ISO 4217 code
+var symbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+}
+
+// currency returns the code of the commodity, or nothing if it's the base
+// one
+func currency(commodity, base string) (string, error) {
+	if code, ok := symbols[commodity]; ok {
+		commodity = code
+	}
+	if commodity == "" || commodity == base {
+		return "", nil
+	}
+
+	if len(commodity) != 3 || strings.Trim(commodity, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("commodity %q isn't a currency, write it as an ISO 4217 code", commodity)
+	}
+
+	return commodity, nil
+}
+
+// parseDate reads dates written with -, / or . and months and days that
+// may have a single digit
+func parseDate(s string) (time.Time, error) {
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == '/' || r == '.'
+	})
+
+	if len(parts) == 3 {
+		y, ey := strconv.Atoi(parts[0])
+		m, em := strconv.Atoi(parts[1])
+		d, ed := strconv.Atoi(parts[2])
+
+		date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+		if ey == nil && em == nil && ed == nil && date.Month() == time.Month(m) && date.Day() == d {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// tags reads a comment made of :tag1:tag2:
+func tags(comment string) []string {
+	comment = strings.TrimSpace(comment)
+	if len(comment) < 3 || comment[0] != ':' || comment[len(comment)-1] != ':' || strings.ContainsAny(comment, " \t") {
+		return nil
+	}
+
+	return strings.Split(comment[1:len(comment)-1], ":")
+}
+
+// cut splits s around the first sep, both sides trimmed
+func cut(s, sep string) (string, string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return strings.TrimSpace(s), ""
+	}
+
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):])
+}
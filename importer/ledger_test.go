@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+const journal = `; opening
+account assets:checking
+
+2020-01-04 * (1234) market | weekly shop
+    ; :food:friday:
+    expenses:food      $52.30
+    assets:checking
+
+2020/1/15=2020/1/16 payroll  ; salary
+    assets          1,500.00 EUR
+    income:work
+
+2020-01-20 transfer
+    assets:checking  -100
+    assets:savings    100
+
+comment
+2020-01-21 hidden
+    expenses  1
+    assets
+end comment
+
+2020-02-30 bad date
+    expenses  1
+    assets
+
+2020-03-01 groceries
+    expenses:food   10 EUR  @ 1.1 USD
+    (budget:food)  -10
+    liabilities:visa  = -500
+
+~ monthly from 2020-01-05  rent  ; :home:
+    expenses:housing  500
+    assets
+
+~ every 2 weeks from 2020-03-01 to 2020-04-01  cleaning
+    expenses  20
+    assets
+
+~ weekly from 2019-01-01 to 2019-02-01  over
+    expenses  1
+    assets
+
+~ every fortnight from 2020-01-01  wrong
+    expenses  1
+    assets
+
+2020-03-02 shares
+    assets  "ACME 1" 3
+    income
+`
+
+func TestLedger(t *testing.T) {
+	type want struct {
+		line        int
+		name        string
+		description string
+		date        time.Time
+		amount      string
+		attrs       stats.Attrs
+	}
+
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	wantRows := []want{
+		{4, "market", "weekly shop", date(2020, 1, 4), "-52.30", stats.Attrs{Currency: "USD", Account: "checking", Category: "food", Tags: []string{"food", "friday"}, Ref: "1234"}},
+		{9, "payroll", "salary", date(2020, 1, 15), "1500", stats.Attrs{Category: "work"}},
+		{27, "groceries", "", date(2020, 3, 1), "-10", stats.Attrs{Account: "visa", Category: "food"}},
+	}
+	wantErrs := []int{13, 23, 44, 48}
+
+	now := date(2020, 2, 10)
+	rows, events, accounts, errs := Ledger(strings.NewReader(journal), "EUR", now)
+
+	if len(rows) != len(wantRows) {
+		t.Fatalf("got %d rows and should be %d: %+v %v", len(rows), len(wantRows), rows, errs)
+	}
+	for i, w := range wantRows {
+		tr := stats.BuildTransaction(w.name, w.description, w.date, amount(w.amount), w.attrs)
+		if rows[i].Line != w.line || !reflect.DeepEqual(rows[i].Transaction, tr) {
+			t.Errorf("%d: got %d %+v and should be %d %+v", i, rows[i].Line, rows[i].Transaction, w.line, tr)
+		}
+	}
+
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("got errors %v and should be at lines %v", errs, wantErrs)
+	}
+	for i, line := range wantErrs {
+		if e, ok := errs[i].(RowError); !ok || e.Line != line {
+			t.Errorf("%d: got %v and should be at line %d", i, errs[i], line)
+		}
+	}
+
+	// only the accounts of what was read
+	wantAccounts := []stats.Account{{Name: "checking", Kind: "checking"}, {Name: "visa", Kind: "credit"}}
+	if !reflect.DeepEqual(accounts, wantAccounts) {
+		t.Errorf("got accounts %+v and should be %+v", accounts, wantAccounts)
+	}
+
+	// occurrences before now are dropped, the ones of over are all gone
+	wantEvents := []EventRow{
+		{32, stats.BuildEvent("rent", "", date(2020, 3, 5), -1, [3]int{0, 1, 0}, amount("-500"), stats.Attrs{Category: "housing", Tags: []string{"home"}})},
+		{36, stats.BuildEvent("cleaning", "", date(2020, 3, 1), 3, [3]int{0, 0, 14}, amount("-20"), stats.Attrs{})},
+	}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("got %+v and should be %+v", events, wantEvents)
+	}
+
+	// the events make it through the ev command they are sent as, rent
+	// keeps repeating after it
+	for i, row := range events {
+		ev, err := stats.ProcessEvent(stats.EventRecord(row.Event))
+		if err != nil || !reflect.DeepEqual(ev, row.Event) {
+			t.Errorf("%d: got %+v and should be %+v: %v", i, ev, row.Event, err)
+		}
+	}
+	ev, _ := stats.ProcessEvent(stats.EventRecord(events[0].Event))
+	if dates := stats.Missed(ev, date(2021, 1, 1)); len(dates) != 10 {
+		t.Errorf("rent fired %d times in 2020", len(dates))
+	}
+
+	// lines of unicode spaces inside an entry are blank
+	rows, _, _, errs = Ledger(strings.NewReader("2020-03-03 blank\n \f\n \u00a0\n    expenses  1\n    assets\n"), "EUR", now)
+	if len(rows) != 1 || len(errs) != 0 {
+		t.Errorf("got %+v %v", rows, errs)
+	}
+}
+
+func TestParseLedgerAmount(t *testing.T) {
+	tests := []struct {
+		in        string
+		amount    string
+		commodity string
+	}{
+		{"$-10.00", "-10", "$"},
+		{"-$10", "-10", "$"},
+		{"10 USD", "10", "USD"},
+		{"EUR 1.000,50", "1000.50", "EUR"},
+		{"1,000", "1000", ""},
+		{"10,5", "10.5", ""},
+		{"\"ACME 1\" 3", "3", "ACME 1"},
+	}
+
+	for i, test := range tests {
+		a, c, err := parseLedgerAmount(test.in)
+		if err != nil {
+			t.Errorf("%d: failed %s", i, err)
+			continue
+		}
+		if a != amount(test.amount) || c != test.commodity {
+			t.Errorf("%d: got %s %q and should be %s %q", i, a, c, test.amount, test.commodity)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// OFX reads the transactions of every statement in an OFX or QFX file,
+// both the SGML of version 1.x and the XML of 2.x. The FITID of each one is
+// kept as its reference so importing it again is noticed. Statements in a
+// currency other than base have it set on their transactions.
+func OFX(in io.Reader, base string) (rows []Row, errs []error) {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return nil, []error{err}
+	}
+	data := string(b)
+
+	// the SGML header is made of plain lines before the first tag
+	start := strings.Index(data, "<OFX>")
+	if start < 0 {
+		return nil, []error{fmt.Errorf("no OFX element")}
+	}
+
+	line := 1 + strings.Count(data[:start], "\n")
+	data = data[start:]
+
+	var (
+		currency string
+		tag      string
+		// the transaction being read and the line it starts at
+		fields map[string]string
+		from   int
+	)
+
+	for len(data) > 0 {
+		i := strings.IndexByte(data, '<')
+		if i < 0 {
+			break
+		}
+
+		// in SGML leaf elements aren't closed, their value is whatever
+		// comes before the next tag
+		if text := strings.TrimSpace(data[:i]); text != "" && tag != "" {
+			text = html.UnescapeString(text)
+
+			if fields != nil {
+				fields[tag] = text
+			} else if tag == "CURDEF" {
+				currency = strings.ToUpper(text)
+			}
+		}
+		line += strings.Count(data[:i], "\n")
+		data = data[i:]
+
+		j := strings.IndexByte(data, '>')
+		if j < 0 {
+			errs = append(errs, RowError{line, fmt.Errorf("unterminated tag")})
+			break
+		}
+		name := strings.ToUpper(strings.TrimSpace(data[1:j]))
+		line += strings.Count(data[:j], "\n")
+		data = data[j+1:]
+
+		switch {
+		case name == "STMTTRN":
+			fields = make(map[string]string)
+			from = line
+			tag = ""
+		case name == "/STMTTRN":
+			if fields == nil {
+				break
+			}
+
+			tr, err := ofxTransaction(fields, currency, base)
+			if err != nil {
+				errs = append(errs, RowError{from, err})
+			} else {
+				rows = append(rows, Row{from, tr})
+			}
+			fields = nil
+			tag = ""
+		case strings.HasPrefix(name, "/"), strings.HasPrefix(name, "?"), strings.HasPrefix(name, "!"), strings.HasSuffix(name, "/"):
+			// closing tags, processing instructions, comments and empty
+			// elements carry no value
+			tag = ""
+		default:
+			tag = name
+		}
+	}
+
+	return
+}
+
+func ofxTransaction(fields map[string]string, currency, base string) (stats.Transaction, error) {
+	// YYYYMMDD followed by an optional time and time zone
+	posted := fields["DTPOSTED"]
+	if len(posted) < 8 {
+		return stats.Transaction{}, fmt.Errorf("invalid DTPOSTED %q", posted)
+	}
+	date, err := time.Parse("20060102", posted[:8])
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+
+	// some banks write a decimal comma
+	value := fields["TRNAMT"]
+	if strings.IndexByte(value, '.') < 0 {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	amount, err := stats.ParseAmount(value)
+	if err != nil {
+		return stats.Transaction{}, err
+	}
+
+	name, description := fields["NAME"], fields["MEMO"]
+	if name == "" {
+		name, description = description, ""
+	}
+	if name == "" {
+		return stats.Transaction{}, fmt.Errorf("no NAME or MEMO")
+	}
+
+	attrs := stats.Attrs{Ref: fields["FITID"]}
+	if base != "" && currency != "" && currency != base {
+		attrs.Currency = currency
+	}
+
+	return stats.BuildTransaction(name, description, date, amount, attrs), nil
+}
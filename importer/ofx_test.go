@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+const sgml = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20200301</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>1<STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<DTSTART>20200201<DTEND>20200229
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20200203120000.000[-5:EST]
+<TRNAMT>-42.10
+<FITID>2020020301
+<NAME>AT&amp;T
+<MEMO>phone bill
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20200215
+<TRNAMT>1500,00
+<FITID>2020021501
+<MEMO>PAYROLL
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>2020
+<TRNAMT>-1
+<FITID>bad
+<NAME>broken
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const xml = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20200110000000</DTPOSTED>
+            <TRNAMT>-9.99</TRNAMT>
+            <FITID>cc-1</FITID>
+            <NAME>Streaming</NAME>
+            <MEMO/>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestOFX(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Base   string
+		Rows   []Row
+		Errors []int
+	}{
+		{sgml, "USD", []Row{{17, ofxRow("AT&T", "phone bill", 2020, 2, 3, "-42.10", "", "2020020301")}, {25, ofxRow("PAYROLL", "", 2020, 2, 15, "1500", "", "2020021501")}}, []int{32}},
+		{xml, "USD", []Row{{9, ofxRow("Streaming", "", 2020, 1, 10, "-9.99", "EUR", "cc-1")}}, nil},
+		{xml, "EUR", []Row{{9, ofxRow("Streaming", "", 2020, 1, 10, "-9.99", "", "cc-1")}}, nil},
+		{xml, "", []Row{{9, ofxRow("Streaming", "", 2020, 1, 10, "-9.99", "", "cc-1")}}, nil},
+		{"OFXHEADER:100\n", "", nil, []int{0}},
+	}
+
+	for i, c := range cases {
+		rows, errs := OFX(strings.NewReader(c.Input), c.Base)
+
+		if len(rows) != len(c.Rows) {
+			t.Errorf("%d: got %d rows and should be %d", i, len(rows), len(c.Rows))
+			continue
+		}
+		for j, row := range rows {
+			exp := c.Rows[j]
+			got := row.Transaction
+			if row.Line != exp.Line || got.Name != exp.Transaction.Name || got.Description != exp.Transaction.Description ||
+				!got.Date.Equal(exp.Transaction.Date) || got.Amount != exp.Transaction.Amount || got.Attrs.Currency != exp.Transaction.Currency || got.Ref != exp.Transaction.Ref {
+				t.Errorf("%d.%d: got %d %+v and should be %d %+v", i, j, row.Line, got, exp.Line, exp.Transaction)
+			}
+		}
+
+		if len(errs) != len(c.Errors) {
+			t.Errorf("%d: got errors %v", i, errs)
+			continue
+		}
+		for j, err := range errs {
+			if e, ok := err.(RowError); ok && e.Line != c.Errors[j] {
+				t.Errorf("%d: got %s and should be at line %d", i, err, c.Errors[j])
+			}
+		}
+	}
+}
+
+func ofxRow(name, description string, year, month, day int, value, currency, ref string) (tr stats.Transaction) {
+	tr.Name = name
+	tr.Description = description
+	tr.Date = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	tr.Amount = amount(value)
+	tr.Currency = currency
+	tr.Ref = ref
+	return
+}
@@ -0,0 +1,69 @@
+package journal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Journal is an append-only file holding every command accepted by the
+// daemon, one per line, in the same format read from the control file.
+type Journal struct {
+	f *os.File
+}
+
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{f}, nil
+}
+
+// Append writes a record at the end of the journal and syncs it to disk
+func (j *Journal) Append(record []string) error {
+	w := csv.NewWriter(j.f)
+	w.Comma = ' '
+
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return j.f.Sync()
+}
+
+// Replay calls apply for every record in the journal, in the order they
+// were appended. It stops at the first record apply fails on.
+func (j *Journal) Replay(apply func([]string) error) error {
+	if _, err := j.f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	r := csv.NewReader(j.f)
+	r.Comma = ' '
+	r.FieldsPerRecord = -1
+
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = apply(record); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,92 @@
+package journal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal")
+
+	records := [][]string{
+		{"tr", "foo", "bar", "2020-01-01", "200"},
+		{"tr", "foo bar", "", "2020-01-02", "-10.5"},
+		{"ev", "rent", "\"flat\"", "2020-01-03", "-1", "0,1,0", "-500"},
+	}
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	for i, r := range records {
+		if err = j.Append(r); err != nil {
+			t.Fatalf("%d: append: %s", i, err)
+		}
+	}
+	if err = j.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	// reopen and read everything back
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %s", err)
+	}
+	defer j.Close()
+
+	var got [][]string
+	err = j.Replay(func(r []string) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+
+	if len(got) != len(records) {
+		t.Fatalf("got %d records and should be %d", len(got), len(records))
+	}
+	for i, r := range records {
+		if len(got[i]) != len(r) {
+			t.Errorf("%d: got %v and should be %v", i, got[i], r)
+			continue
+		}
+		for k := range r {
+			if got[i][k] != r[k] {
+				t.Errorf("%d - %d: got %s and should be %s", i, k, got[i][k], r[k])
+			}
+		}
+	}
+
+	// appending after a replay still lands at the end
+	if err = j.Append([]string{"tr", "x", "y", "2020-01-04", "1"}); err != nil {
+		t.Fatalf("append after replay: %s", err)
+	}
+
+	count := 0
+	j.Replay(func(r []string) error {
+		count++
+		return nil
+	})
+	if count != len(records)+1 {
+		t.Errorf("got %d records after append and should be %d", count, len(records)+1)
+	}
+
+	// errors stop the replay
+	stop := errors.New("stop")
+	err = j.Replay(func(r []string) error {
+		return stop
+	})
+	if err == nil {
+		t.Errorf("replay should have failed")
+	}
+}
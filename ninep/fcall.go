@@ -0,0 +1,220 @@
+// Package ninep serves a tree of synthetic files over 9P2000.
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// message types
+const (
+	Tversion = 100 + iota
+	Rversion
+	Tauth
+	Rauth
+	Tattach
+	Rattach
+	Terror // never sent
+	Rerror
+	Tflush
+	Rflush
+	Twalk
+	Rwalk
+	Topen
+	Ropen
+	Tcreate
+	Rcreate
+	Tread
+	Rread
+	Twrite
+	Rwrite
+	Tclunk
+	Rclunk
+	Tremove
+	Rremove
+	Tstat
+	Rstat
+	Twstat
+	Rwstat
+)
+
+// open modes
+const (
+	OREAD   = 0
+	OWRITE  = 1
+	ORDWR   = 2
+	OEXEC   = 3
+	OTRUNC  = 0x10
+	ORCLOSE = 0x40
+)
+
+const (
+	QTDIR = 0x80
+	DMDIR = 0x80000000
+
+	NOTAG = 0xffff
+	NOFID = 0xffffffff
+
+	// size[4] type[1] tag[2] fid[4] offset[8] count[4]
+	IOHDRSZ = 23
+)
+
+var errShort = errors.New("short message")
+
+type Qid struct {
+	Type    uint8
+	Version uint32
+	Path    uint64
+}
+
+type Dir struct {
+	Type   uint16
+	Dev    uint32
+	Qid    Qid
+	Mode   uint32
+	Atime  uint32
+	Mtime  uint32
+	Length uint64
+	Name   string
+	Uid    string
+	Gid    string
+	Muid   string
+}
+
+// buffer builds a message, the size is filled in by bytes
+type buffer struct {
+	b []byte
+}
+
+func newMessage(typ uint8, tag uint16) *buffer {
+	m := &buffer{make([]byte, 4, 64)}
+	m.u8(typ)
+	m.u16(tag)
+	return m
+}
+
+func (m *buffer) bytes() []byte {
+	binary.LittleEndian.PutUint32(m.b, uint32(len(m.b)))
+	return m.b
+}
+
+func (m *buffer) u8(v uint8) {
+	m.b = append(m.b, v)
+}
+
+func (m *buffer) u16(v uint16) {
+	m.b = binary.LittleEndian.AppendUint16(m.b, v)
+}
+
+func (m *buffer) u32(v uint32) {
+	m.b = binary.LittleEndian.AppendUint32(m.b, v)
+}
+
+func (m *buffer) u64(v uint64) {
+	m.b = binary.LittleEndian.AppendUint64(m.b, v)
+}
+
+func (m *buffer) str(s string) {
+	m.u16(uint16(len(s)))
+	m.b = append(m.b, s...)
+}
+
+func (m *buffer) qid(q Qid) {
+	m.u8(q.Type)
+	m.u32(q.Version)
+	m.u64(q.Path)
+}
+
+// data appends count[4] followed by the bytes
+func (m *buffer) data(d []byte) {
+	m.u32(uint32(len(d)))
+	m.b = append(m.b, d...)
+}
+
+// stat appends the machine independent form of the directory entry, the
+// caller adds the extra size[2] a Rstat needs
+func (m *buffer) stat(d Dir) {
+	start := len(m.b)
+	m.u16(0)
+
+	m.u16(d.Type)
+	m.u32(d.Dev)
+	m.qid(d.Qid)
+	m.u32(d.Mode)
+	m.u32(d.Atime)
+	m.u32(d.Mtime)
+	m.u64(d.Length)
+	m.str(d.Name)
+	m.str(d.Uid)
+	m.str(d.Gid)
+	m.str(d.Muid)
+
+	binary.LittleEndian.PutUint16(m.b[start:], uint16(len(m.b)-start-2))
+}
+
+// reader takes the fields of a received message in order, once a field is
+// missing every following one is zero and err is set
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		// enough for the fixed size fields, the message is dropped anyway
+		r.err = errShort
+		return make([]byte, 8)
+	}
+
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) u8() uint8 {
+	return r.take(1)[0]
+}
+
+func (r *reader) u16() uint16 {
+	return binary.LittleEndian.Uint16(r.take(2))
+}
+
+func (r *reader) u32() uint32 {
+	return binary.LittleEndian.Uint32(r.take(4))
+}
+
+func (r *reader) u64() uint64 {
+	return binary.LittleEndian.Uint64(r.take(8))
+}
+
+func (r *reader) str() string {
+	return string(r.take(int(r.u16())))
+}
+
+func (r *reader) qid() (q Qid) {
+	q.Type = r.u8()
+	q.Version = r.u32()
+	q.Path = r.u64()
+	return
+}
+
+// data takes count[4] followed by the bytes
+func (r *reader) data() []byte {
+	return r.take(int(r.u32()))
+}
+
+func (r *reader) stat() (d Dir) {
+	r.u16()
+	d.Type = r.u16()
+	d.Dev = r.u32()
+	d.Qid = r.qid()
+	d.Mode = r.u32()
+	d.Atime = r.u32()
+	d.Mtime = r.u32()
+	d.Length = r.u64()
+	d.Name = r.str()
+	d.Uid = r.str()
+	d.Gid = r.str()
+	d.Muid = r.str()
+	return
+}
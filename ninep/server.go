@@ -0,0 +1,531 @@
+package ninep
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// File is a node of the served tree. Directories have List, files have
+// Read, Write or both.
+type File struct {
+	Name string
+	// children of a directory, asked for on every walk and directory read
+	List func() []*File
+	// content of the file, taken when it is opened
+	Read func() ([]byte, error)
+	// called once for every write request, an error is sent back to the
+	// client
+	Write func([]byte) error
+}
+
+func (f *File) isDir() bool {
+	return f.List != nil
+}
+
+func (f *File) child(name string) *File {
+	for _, c := range f.List() {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+type Server struct {
+	Root *File
+	// owner of every file
+	User string
+}
+
+const (
+	version = "9P2000"
+	msize   = 8192 + IOHDRSZ
+)
+
+var (
+	errNoFid    = errors.New("unknown fid")
+	errFidInUse = errors.New("fid in use")
+	errNotFound = errors.New("file does not exist")
+	errPerm     = errors.New("permission denied")
+	errNotDir   = errors.New("not a directory")
+	errOpen     = errors.New("file already open")
+	errNotOpen  = errors.New("file not open")
+	errNoAuth   = errors.New("authentication not required")
+	errNoVer    = errors.New("version not negotiated")
+	errBadMsg   = errors.New("bad message")
+)
+
+/*
+* tcp!<host>!<port>
+* tcp!localhost!5640
+* unix!/run/domestic-advisor/9p
+ */
+func Listen(dial string) (net.Listener, error) {
+	parts := strings.Split(dial, "!")
+
+	switch {
+	case len(parts) == 3 && parts[0] == "tcp":
+		return net.Listen("tcp", net.JoinHostPort(parts[1], parts[2]))
+	case len(parts) == 2 && parts[0] == "unix":
+		return ListenUnix(parts[1])
+	}
+
+	return nil, fmt.Errorf("%q is not a tcp or unix dial string", dial)
+}
+
+// ListenUnix listens on the unix socket at path, removing first a socket
+// left behind by a daemon that didn't exit cleanly
+func ListenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	return net.Listen("unix", path)
+}
+
+// Serve answers every connection accepted by the listener until it is
+// closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn answers the requests of a single client, one at a time
+func (s *Server) ServeConn(c io.ReadWriteCloser) {
+	defer c.Close()
+
+	conn := &conn{s, make(map[uint32]*fid), msize, false}
+	r := bufio.NewReader(c)
+
+	for {
+		req, err := readMessage(r, conn.msize)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("9p: %s\n", err)
+			}
+			return
+		}
+
+		if _, err = c.Write(conn.handle(req)); err != nil {
+			log.Printf("9p: %s\n", err)
+			return
+		}
+	}
+}
+
+func readMessage(r io.Reader, max uint32) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 7 || n > max {
+		return nil, fmt.Errorf("message of %d bytes", n)
+	}
+
+	msg := make([]byte, n-4)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+type conn struct {
+	srv     *Server
+	fids    map[uint32]*fid
+	msize   uint32
+	started bool
+}
+
+type fid struct {
+	// from the root to the file, walking .. goes back one
+	path []*File
+	open bool
+	mode uint8
+	// content of the file or the entries of the directory at open
+	data []byte
+}
+
+func (f *fid) file() *File {
+	return f.path[len(f.path)-1]
+}
+
+func (f *fid) qid() Qid {
+	h := fnv.New64a()
+	for _, file := range f.path[1:] {
+		h.Write([]byte(file.Name))
+		h.Write([]byte{'/'})
+	}
+
+	q := Qid{Path: h.Sum64()}
+	if f.file().isDir() {
+		q.Type = QTDIR
+	}
+
+	return q
+}
+
+func (c *conn) stat(f *fid) Dir {
+	file := f.file()
+
+	d := Dir{
+		Qid:  f.qid(),
+		Name: file.Name,
+		Uid:  c.srv.User,
+		Gid:  c.srv.User,
+		Muid: c.srv.User,
+	}
+
+	if file.isDir() {
+		d.Mode = DMDIR | 0555
+	}
+	if file.Read != nil {
+		d.Mode |= 0444
+	}
+	if file.Write != nil {
+		d.Mode |= 0222
+	}
+
+	return d
+}
+
+// handle answers a request, the message starts with its type
+func (c *conn) handle(req []byte) []byte {
+	r := &reader{b: req[1:]}
+	typ := req[0]
+	tag := r.u16()
+
+	if typ != Tversion && !c.started {
+		return rerror(tag, errNoVer)
+	}
+
+	var resp *buffer
+	var err error
+
+	switch typ {
+	case Tversion:
+		resp, err = c.version(r, tag)
+	case Tauth:
+		err = errNoAuth
+	case Tattach:
+		resp, err = c.attach(r, tag)
+	case Tflush:
+		// requests are answered in order, there is nothing to flush
+		resp = newMessage(Rflush, tag)
+	case Twalk:
+		resp, err = c.walk(r, tag)
+	case Topen:
+		resp, err = c.open(r, tag)
+	case Tcreate, Tremove:
+		// remove clunks the fid even if it fails
+		if typ == Tremove {
+			delete(c.fids, r.u32())
+		}
+		err = errPerm
+	case Tread:
+		resp, err = c.read(r, tag)
+	case Twrite:
+		resp, err = c.write(r, tag)
+	case Tclunk:
+		id := r.u32()
+		if _, ok := c.fids[id]; !ok {
+			err = errNoFid
+			break
+		}
+		delete(c.fids, id)
+		resp = newMessage(Rclunk, tag)
+	case Tstat:
+		var f *fid
+		if f, err = c.fid(r.u32()); err != nil {
+			break
+		}
+		resp = newMessage(Rstat, tag)
+		st := &buffer{}
+		st.stat(c.stat(f))
+		resp.u16(uint16(len(st.b)))
+		resp.b = append(resp.b, st.b...)
+	case Twstat:
+		// shells and editors truncate files before writing them, the
+		// changes are accepted and ignored
+		if _, err = c.fid(r.u32()); err == nil {
+			resp = newMessage(Rwstat, tag)
+		}
+	default:
+		err = errBadMsg
+	}
+
+	if err == nil && r.err != nil {
+		err = errBadMsg
+	}
+	if err != nil {
+		return rerror(tag, err)
+	}
+
+	return resp.bytes()
+}
+
+func rerror(tag uint16, err error) []byte {
+	resp := newMessage(Rerror, tag)
+	resp.str(err.Error())
+	return resp.bytes()
+}
+
+func (c *conn) fid(id uint32) (*fid, error) {
+	f, ok := c.fids[id]
+	if !ok {
+		return nil, errNoFid
+	}
+
+	return f, nil
+}
+
+func (c *conn) version(r *reader, tag uint16) (*buffer, error) {
+	size := r.u32()
+	v := r.str()
+
+	// a new version aborts everything going on
+	c.fids = make(map[uint32]*fid)
+
+	if size < 256 {
+		return nil, fmt.Errorf("msize %d too small", size)
+	}
+	if size < c.msize {
+		c.msize = size
+	}
+
+	resp := newMessage(Rversion, tag)
+	resp.u32(c.msize)
+
+	// 9P2000.u and 9P2000.L clients fall back to the plain protocol
+	if strings.HasPrefix(v, version) {
+		c.started = true
+		resp.str(version)
+	} else {
+		c.started = false
+		resp.str("unknown")
+	}
+
+	return resp, nil
+}
+
+func (c *conn) attach(r *reader, tag uint16) (*buffer, error) {
+	id := r.u32()
+	afid := r.u32()
+	r.str()
+	r.str()
+
+	if afid != NOFID {
+		return nil, errNoAuth
+	}
+	if _, ok := c.fids[id]; ok {
+		return nil, errFidInUse
+	}
+
+	f := &fid{path: []*File{c.srv.Root}}
+	c.fids[id] = f
+
+	resp := newMessage(Rattach, tag)
+	resp.qid(f.qid())
+	return resp, nil
+}
+
+func (c *conn) walk(r *reader, tag uint16) (*buffer, error) {
+	f, err := c.fid(r.u32())
+	if err != nil {
+		return nil, err
+	}
+	newid := r.u32()
+
+	names := make([]string, r.u16())
+	for i := range names {
+		names[i] = r.str()
+	}
+
+	if f.open {
+		return nil, errOpen
+	}
+	if _, ok := c.fids[newid]; ok && c.fids[newid] != f {
+		return nil, errFidInUse
+	}
+
+	path := append([]*File(nil), f.path...)
+	resp := newMessage(Rwalk, tag)
+	qids := make([]Qid, 0, len(names))
+
+	for _, name := range names {
+		file := path[len(path)-1]
+		if !file.isDir() {
+			err = errNotDir
+			break
+		}
+
+		switch name {
+		case "..":
+			if len(path) > 1 {
+				path = path[:len(path)-1]
+			}
+		case ".":
+		default:
+			next := file.child(name)
+			if next == nil {
+				err = errNotFound
+				break
+			}
+			path = append(path, next)
+		}
+		if err != nil {
+			break
+		}
+
+		qids = append(qids, (&fid{path: path}).qid())
+	}
+
+	// failing on the first name is an error, after that the client gets
+	// the qids walked so far and newfid is left alone
+	if len(qids) == 0 && len(names) > 0 {
+		return nil, err
+	}
+	if len(qids) == len(names) {
+		c.fids[newid] = &fid{path: path}
+	}
+
+	resp.u16(uint16(len(qids)))
+	for _, q := range qids {
+		resp.qid(q)
+	}
+
+	return resp, nil
+}
+
+func (c *conn) open(r *reader, tag uint16) (*buffer, error) {
+	f, err := c.fid(r.u32())
+	if err != nil {
+		return nil, err
+	}
+	mode := r.u8()
+
+	if f.open {
+		return nil, errOpen
+	}
+	if mode&ORCLOSE != 0 {
+		return nil, errPerm
+	}
+
+	file := f.file()
+	read := mode&3 == OREAD || mode&3 == ORDWR || mode&3 == OEXEC
+	write := mode&3 == OWRITE || mode&3 == ORDWR
+
+	switch {
+	case file.isDir():
+		if write || mode&OTRUNC != 0 {
+			return nil, errPerm
+		}
+		// the entries are kept so the client reads a consistent listing
+		d := &buffer{}
+		for _, child := range file.List() {
+			d.stat(c.stat(&fid{path: append(f.path[:len(f.path):len(f.path)], child)}))
+		}
+		f.data = d.b
+	case read && file.Read == nil, write && file.Write == nil:
+		return nil, errPerm
+	case read:
+		if f.data, err = file.Read(); err != nil {
+			return nil, err
+		}
+	}
+
+	f.open = true
+	f.mode = mode
+
+	resp := newMessage(Ropen, tag)
+	resp.qid(f.qid())
+	resp.u32(c.msize - IOHDRSZ)
+	return resp, nil
+}
+
+func (c *conn) read(r *reader, tag uint16) (*buffer, error) {
+	f, err := c.fid(r.u32())
+	if err != nil {
+		return nil, err
+	}
+	offset := r.u64()
+	count := r.u32()
+
+	if !f.open {
+		return nil, errNotOpen
+	}
+	if max := c.msize - IOHDRSZ; count > max {
+		count = max
+	}
+
+	var data []byte
+	if offset < uint64(len(f.data)) {
+		data = f.data[offset:]
+	}
+
+	if f.file().isDir() {
+		// only whole entries are sent
+		n := 0
+		for n+2 <= len(data) {
+			size := 2 + int(binary.LittleEndian.Uint16(data[n:]))
+			if uint32(n+size) > count {
+				break
+			}
+			n += size
+		}
+		data = data[:n]
+	} else if uint32(len(data)) > count {
+		data = data[:count]
+	}
+
+	resp := newMessage(Rread, tag)
+	resp.data(data)
+	return resp, nil
+}
+
+func (c *conn) write(r *reader, tag uint16) (*buffer, error) {
+	f, err := c.fid(r.u32())
+	if err != nil {
+		return nil, err
+	}
+	r.u64()
+	data := r.data()
+
+	if r.err != nil {
+		return nil, errBadMsg
+	}
+	if !f.open {
+		return nil, errNotOpen
+	}
+	if f.mode&3 != OWRITE && f.mode&3 != ORDWR {
+		return nil, errPerm
+	}
+
+	if err = f.file().Write(data); err != nil {
+		return nil, err
+	}
+
+	resp := newMessage(Rwrite, tag)
+	resp.u32(uint32(len(data)))
+	return resp, nil
+}
@@ -0,0 +1,307 @@
+package ninep
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// client sends one request at a time and returns the reader of the answer
+type client struct {
+	t *testing.T
+	c net.Conn
+}
+
+func (c *client) rpc(req *buffer, typ uint8) (*reader, error) {
+	c.t.Helper()
+
+	if _, err := c.c.Write(req.bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+
+	msg, err := readMessage(c.c, msize)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	r := &reader{b: msg[1:]}
+	r.u16()
+
+	if msg[0] == Rerror {
+		return nil, errors.New(r.str())
+	}
+	if msg[0] != typ {
+		c.t.Fatalf("got message %d and should be %d", msg[0], typ)
+	}
+
+	return r, nil
+}
+
+func (c *client) walk(fid, newfid uint32, names ...string) ([]Qid, error) {
+	m := newMessage(Twalk, 1)
+	m.u32(fid)
+	m.u32(newfid)
+	m.u16(uint16(len(names)))
+	for _, name := range names {
+		m.str(name)
+	}
+
+	r, err := c.rpc(m, Rwalk)
+	if err != nil {
+		return nil, err
+	}
+
+	qids := make([]Qid, r.u16())
+	for i := range qids {
+		qids[i] = r.qid()
+	}
+	return qids, nil
+}
+
+func (c *client) open(fid uint32, mode uint8) error {
+	m := newMessage(Topen, 1)
+	m.u32(fid)
+	m.u8(mode)
+
+	_, err := c.rpc(m, Ropen)
+	return err
+}
+
+func (c *client) read(fid uint32, offset uint64, count uint32) ([]byte, error) {
+	m := newMessage(Tread, 1)
+	m.u32(fid)
+	m.u64(offset)
+	m.u32(count)
+
+	r, err := c.rpc(m, Rread)
+	if err != nil {
+		return nil, err
+	}
+	return r.data(), nil
+}
+
+func (c *client) write(fid uint32, data string) error {
+	m := newMessage(Twrite, 1)
+	m.u32(fid)
+	m.u64(0)
+	m.data([]byte(data))
+
+	_, err := c.rpc(m, Rwrite)
+	return err
+}
+
+func (c *client) clunk(fid uint32) error {
+	m := newMessage(Tclunk, 1)
+	m.u32(fid)
+
+	_, err := c.rpc(m, Rclunk)
+	return err
+}
+
+func newClient(t *testing.T, root *File) *client {
+	a, b := net.Pipe()
+	go (&Server{Root: root, User: "glenda"}).ServeConn(a)
+	t.Cleanup(func() { b.Close() })
+
+	c := &client{t, b}
+
+	m := newMessage(Tversion, NOTAG)
+	m.u32(msize)
+	m.str("9P2000.L")
+	r, err := c.rpc(m, Rversion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.u32(); r.str() != version {
+		t.Fatalf("version not negotiated")
+	}
+
+	m = newMessage(Tattach, 1)
+	m.u32(0)
+	m.u32(NOFID)
+	m.str("glenda")
+	m.str("")
+	if _, err = c.rpc(m, Rattach); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestServer(t *testing.T) {
+	var written []string
+
+	files := []*File{
+		{Name: "ctl", Write: func(b []byte) error {
+			if strings.HasPrefix(string(b), "bad") {
+				return errors.New("bad command")
+			}
+			written = append(written, string(b))
+			return nil
+		}},
+		{Name: "status", Read: func() ([]byte, error) {
+			return []byte("hello world\n"), nil
+		}},
+	}
+	sub := &File{Name: "sub", List: func() []*File { return files[1:] }}
+	root := &File{Name: "/", List: func() []*File { return append(files, sub) }}
+
+	c := newClient(t, root)
+
+	// read a file in two requests
+	if _, err := c.walk(0, 1, "status"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.open(1, OREAD); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := c.read(1, 0, 5)
+	b, _ := c.read(1, 5, 100)
+	if string(a)+string(b) != "hello world\n" {
+		t.Errorf("got %q%q", a, b)
+	}
+	if err := c.write(1, "x"); err == nil {
+		t.Errorf("writing a file open for reading should fail")
+	}
+	c.clunk(1)
+
+	// write commands, errors go back to the client
+	c.walk(0, 1, "ctl")
+	if err := c.open(1, OREAD); err == nil {
+		t.Errorf("reading ctl should fail")
+	}
+	if err := c.open(1, OWRITE|OTRUNC); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.write(1, "tr foo bar 2020-01-01 1\n"); err != nil {
+		t.Error(err)
+	}
+	if err := c.write(1, "bad\n"); err == nil || err.Error() != "bad command" {
+		t.Errorf("got %v and should be bad command", err)
+	}
+	if len(written) != 1 {
+		t.Errorf("got %d writes and should be 1", len(written))
+	}
+	c.clunk(1)
+
+	// walks
+	qids, err := c.walk(0, 2, "sub", "..", "sub", "status")
+	if err != nil || len(qids) != 4 {
+		t.Fatalf("got %v %v", qids, err)
+	}
+	if qids[0].Type != QTDIR || qids[3].Type != 0 {
+		t.Errorf("wrong qid types %v", qids)
+	}
+	if qids[1] != (&fid{path: []*File{root}}).qid() {
+		t.Errorf("walking .. should go back to the root")
+	}
+	if qids, err = c.walk(0, 3, "sub", "nope"); err != nil || len(qids) != 1 {
+		t.Errorf("partial walk got %v %v", qids, err)
+	}
+	if err = c.open(3, OREAD); err == nil {
+		t.Errorf("a partial walk should not set newfid")
+	}
+	if _, err = c.walk(0, 3, "nope"); err == nil {
+		t.Errorf("walking to a missing file should fail")
+	}
+	if _, err = c.walk(0, 2, "status"); err == nil {
+		t.Errorf("newfid in use should fail")
+	}
+
+	// directory listing, one entry at a time
+	c.walk(0, 4)
+	if err = c.open(4, OREAD); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for offset := uint64(0); ; {
+		b, err := c.read(4, offset, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) == 0 {
+			break
+		}
+		offset += uint64(len(b))
+
+		r := &reader{b: b}
+		for len(r.b) > 0 {
+			d := r.stat()
+			if d.Uid != "glenda" {
+				t.Errorf("got owner %s", d.Uid)
+			}
+			names = append(names, d.Name)
+		}
+	}
+	if strings.Join(names, " ") != "ctl status sub" {
+		t.Errorf("got entries %v", names)
+	}
+
+	// stat
+	m := newMessage(Tstat, 1)
+	m.u32(2)
+	r, err := c.rpc(m, Rstat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.u16()
+	if d := r.stat(); d.Name != "status" || d.Mode != 0444 {
+		t.Errorf("got %+v", d)
+	}
+
+	if err = c.clunk(9); err == nil {
+		t.Errorf("clunking an unknown fid should fail")
+	}
+}
+
+func TestListen(t *testing.T) {
+	for _, dial := range []string{"localhost:5640", "tcp!localhost", "udp!localhost!5640"} {
+		if _, err := Listen(dial); err == nil {
+			t.Errorf("%s should fail", dial)
+		}
+	}
+
+	l, err := Listen("tcp!127.0.0.1!0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ninep_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a socket left behind is replaced
+	path := filepath.Join(dir, "sock")
+	l, err := ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	if l, err = ListenUnix(path); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// anything else is left alone
+	path = filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(path, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ListenUnix(path); err == nil {
+		t.Errorf("listening on a file should fail")
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "keep" {
+		t.Errorf("got %q: %v", b, err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/argot42/DomesticAdvisor/ninep"
+	"github.com/argot42/DomesticAdvisor/stats"
+)
+
+// listenSocket accepts commands on the unix socket of the configuration,
+// closing the one that was open before
+func (d *daemon) listenSocket() error {
+	l, err := openSocket(d.cfg.SocketPath)
+	if err != nil {
+		return err
+	}
+
+	d.serveSocket(l)
+	return nil
+}
+
+// openSocket listens on the unix socket, there is no listener if the path
+// is empty
+func openSocket(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	l, err := ninep.ListenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %s", err)
+	}
+
+	return l, nil
+}
+
+// serveSocket closes the socket that was open and takes commands on l
+func (d *daemon) serveSocket(l net.Listener) {
+	if d.sock != nil {
+		d.sock.Close()
+		d.sock = nil
+	}
+
+	if l == nil {
+		return
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serveConn(c)
+		}
+	}()
+
+	d.sock = l
+	log.Println("listening for commands on", l.Addr())
+}
+
+/*
+* > tr foo bar 2020-01-01 200
+* < ok 3
+* > ac cash cash
+* < ok
+* > tr foo bar 2020-13-01 200
+* < err process transaction: parsing time "2020-13-01": month out of range
+ */
+func (d *daemon) serveConn(c net.Conn) {
+	defer c.Close()
+
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var answer string
+
+		parsed, err := stats.Parse(bytes.NewReader(line))
+		if err == nil {
+			var res stats.Result
+			if res, err = d.submit(parsed); err == nil {
+				answer = "ok"
+				if res.Kind != "" {
+					answer = fmt.Sprintf("ok %d", res.Id)
+				}
+			}
+		} else {
+			err = fmt.Errorf("parsing: %s", err)
+		}
+
+		if err != nil {
+			// one answer per line
+			answer = "err " + strings.ReplaceAll(err.Error(), "\n", " ")
+		}
+
+		if _, err = fmt.Fprintln(c, answer); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socket_")
+	if err != nil {
+		t.Fatalf("Tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := testDaemon(t, dir, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	d.cfg.SocketPath = filepath.Join(dir, "sock")
+	if err = d.listenSocket(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.sock.Close()
+
+	c, err := net.Dial("unix", d.cfg.SocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// several lines in a single write, blank ones get no answer
+	lines := []string{
+		"tr market food 2020-01-10 -30",
+		"",
+		"ac cash cash",
+		"tr foo bar 2020-13-01 200",
+		`tr "unterminated`,
+		"ev rent flat 2020-02-01 -1 0,1,0 -500",
+	}
+	if _, err = fmt.Fprintln(c, strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := []string{
+		"ok 0",
+		"ok",
+		"err process transaction",
+		"err parsing",
+		"ok 0",
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	scanner := bufio.NewScanner(c)
+	for i, want := range answers {
+		if !scanner.Scan() {
+			t.Fatalf("%d: no answer: %v", i, scanner.Err())
+		}
+		if got := scanner.Text(); !strings.HasPrefix(got, want) {
+			t.Errorf("%d: got %q and should start with %q", i, got, want)
+		}
+	}
+
+	if n, m := len(d.ledger.Transactions()), len(d.ledger.Events()); n != 1 || m != 1 {
+		t.Errorf("got %d transactions and %d events", n, m)
+	}
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"fmt"
+)
+
+// kinds of account
+var AccountKinds = []string{"checking", "savings", "cash", "credit"}
+
+type Account struct {
+	Name        string
+	Kind        string
+	Description string
+}
+
+// AccountActivity is the section of the stats for a single account
+type AccountActivity struct {
+	Name string
+	Kind string
+	Activity
+}
+
+func ProcessAccount(in []string) (Account, error) {
+	/*
+	 * ac    <name>      <kind>      [description]
+	 * ac    savings     savings     "rainy day fund"
+	 */
+	if len(in) < 3 {
+		return Account{}, fmt.Errorf("process account: missing arguments")
+	}
+
+	if in[1] == "" {
+		return Account{}, fmt.Errorf("process account: empty name")
+	}
+
+	kind := ""
+	for _, k := range AccountKinds {
+		if in[2] == k {
+			kind = k
+		}
+	}
+	if kind == "" {
+		return Account{}, fmt.Errorf("process account: %q is not a kind of account", in[2])
+	}
+
+	var description string
+	if len(in) > 3 {
+		description = in[3]
+	}
+
+	return Account{in[1], kind, description}, nil
+}
+
+func FindAccount(name string, accounts []Account) int {
+	for i, ac := range accounts {
+		if ac.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessAccount(t *testing.T) {
+	cases := []struct {
+		Input   []string
+		Output  Account
+		Success bool
+	}{
+		{[]string{"ac", "savings", "savings", "rainy day"}, Account{"savings", "savings", "rainy day"}, true},
+		{[]string{"ac", "wallet", "cash"}, Account{"wallet", "cash", ""}, true},
+		{[]string{"ac", "visa", "credit"}, Account{"visa", "credit", ""}, true},
+		{[]string{"ac", "wallet", "pocket"}, Account{}, false},
+		{[]string{"ac", "", "cash"}, Account{}, false},
+		{[]string{"ac", "wallet"}, Account{}, false},
+	}
+
+	for i, c := range cases {
+		ac, err := ProcessAccount(c.Input)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+		if !c.Success {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+		if ac != c.Output {
+			t.Errorf("%d: got %+v and should be %+v", i, ac, c.Output)
+		}
+	}
+}
+
+func TestBuildStatsAccounts(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	accounts := []Account{
+		{"checking", "checking", ""},
+		{"wallet", "cash", ""},
+		{"savings", "savings", ""},
+	}
+	trs := []Transaction{
+		{0, "salary", "", date, amount("1000"), Attrs{Account: "checking"}},
+		{1, "atm", "", date, amount("-100"), Attrs{Account: "checking"}},
+		{2, "atm", "", date, amount("100"), Attrs{Account: "wallet"}},
+		{3, "coffee", "", date, amount("-2.5"), Attrs{Account: "wallet"}},
+		{4, "found", "", date, amount("5"), Attrs{}},
+	}
+
+	s := BuildStats(trs, nil, nil, accounts, nil, Settings{})
+
+	if s.Treasury.Total != amount("1002.5") {
+		t.Errorf("treasury is %s and should be 1002.5", s.Treasury.Total)
+	}
+
+	if len(s.Accounts) != len(accounts) {
+		t.Fatalf("got %d accounts and should be %d", len(s.Accounts), len(accounts))
+	}
+
+	expected := []struct {
+		Total   Amount
+		Entries int
+	}{
+		{amount("900"), 2},
+		{amount("97.5"), 2},
+		{0, 0},
+	}
+	for i, e := range expected {
+		ac := s.Accounts[i]
+		if ac.Name != accounts[i].Name || ac.Kind != accounts[i].Kind {
+			t.Errorf("%d: got account %s (%s)", i, ac.Name, ac.Kind)
+		}
+		if ac.Total != e.Total {
+			t.Errorf("%d: total is %s and should be %s", i, ac.Total, e.Total)
+		}
+		if len(ac.Entries) != e.Entries {
+			t.Errorf("%d: got %d entries and should be %d", i, len(ac.Entries), e.Entries)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of money stored as an integer number of minor
+// units (cents when there are two decimal places), so adding amounts up
+// is always exact
+type Amount int64
+
+var minorUnits = 2
+var scale int64 = 100
+
+// SetMinorUnits sets how many decimal places amounts have. It must be
+// called before any amount is parsed since it changes what the stored
+// integers mean.
+func SetMinorUnits(n int) error {
+	if n < 0 || n > 9 {
+		return fmt.Errorf("minor units should be between 0 and 9")
+	}
+
+	minorUnits = n
+	scale = 1
+	for i := 0; i < n; i++ {
+		scale *= 10
+	}
+
+	return nil
+}
+
+func MinorUnits() int {
+	return minorUnits
+}
+
+/*
+* [+-]<units>[.<minor units>]
+* -1234.5
+ */
+func ParseAmount(s string) (Amount, error) {
+	str := s
+
+	negative := false
+	if str != "" && (str[0] == '-' || str[0] == '+') {
+		negative = str[0] == '-'
+		str = str[1:]
+	}
+
+	units, minor := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		units, minor = str[:i], str[i+1:]
+	}
+
+	if units == "" && minor == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	// extra decimal places are only accepted when they are zero
+	if len(minor) > minorUnits {
+		if strings.Trim(minor[minorUnits:], "0") != "" {
+			return 0, fmt.Errorf("amount %q has more than %d decimal places", s, minorUnits)
+		}
+		minor = minor[:minorUnits]
+	}
+	minor += strings.Repeat("0", minorUnits-len(minor))
+
+	if !digits(units) || !digits(minor) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var u, m int64
+	var err error
+
+	if units != "" {
+		if u, err = strconv.ParseInt(units, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if minor != "" {
+		if m, err = strconv.ParseInt(minor, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	if u > (1<<63-1-m)/scale {
+		return 0, fmt.Errorf("amount %q is too big", s)
+	}
+
+	a := Amount(u*scale + m)
+	if negative {
+		a = -a
+	}
+
+	return a, nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String formats the amount with all its decimal places
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-a)
+	}
+
+	if minorUnits == 0 {
+		return sign + strconv.FormatUint(u, 10)
+	}
+
+	return fmt.Sprintf("%s%d.%0*d", sign, u/uint64(scale), minorUnits, u%uint64(scale))
+}
+
+// MarshalJSON writes the amount as a plain JSON number without trailing
+// zeros in the decimal part
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := a.String()
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	return []byte(s), nil
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseAmount(strings.Trim(string(b), "\""))
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		Input   string
+		Output  Amount
+		Success bool
+	}{
+		{"100", 10000, true},
+		{"30.10", 3010, true},
+		{"30.1", 3010, true},
+		{"-22.1", -2210, true},
+		{"+5", 500, true},
+		{".5", 50, true},
+		{"7.", 700, true},
+		{"1.500", 150, true},
+		{"1.505", 0, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{".", 0, false},
+		{"1,5", 0, false},
+		{"1e3", 0, false},
+		{"--1", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+
+	for i, c := range cases {
+		a, err := ParseAmount(c.Input)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+
+		if !c.Success {
+			t.Errorf("%d: should have failed but got %s", i, a)
+			continue
+		}
+
+		if a != c.Output {
+			t.Errorf("%d: got %d and should be %d", i, a, c.Output)
+		}
+	}
+}
+
+func TestAmountSum(t *testing.T) {
+	// 0.1 can't be represented as a float, summing it is where float64 drifts
+	var total Amount
+	for i := 0; i < 1000; i++ {
+		total += amount("0.1")
+	}
+
+	if total.String() != "100.00" {
+		t.Errorf("total is %s and should be 100.00", total)
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	cases := []struct {
+		Input  Amount
+		Output string
+	}{
+		{amount("1234.56"), "1234.56"},
+		{amount("100.4"), "100.4"},
+		{amount("-0.05"), "-0.05"},
+		{amount("200"), "200"},
+		{0, "0"},
+	}
+
+	for i, c := range cases {
+		b, err := json.Marshal(c.Input)
+		if err != nil {
+			t.Errorf("%d: failed %s", i, err)
+			continue
+		}
+		if string(b) != c.Output {
+			t.Errorf("%d: got %s and should be %s", i, b, c.Output)
+		}
+
+		var back Amount
+		if err = json.Unmarshal(b, &back); err != nil {
+			t.Errorf("%d: unmarshal failed %s", i, err)
+			continue
+		}
+		if back != c.Input {
+			t.Errorf("%d: got %s back and should be %s", i, back, c.Input)
+		}
+	}
+}
+
+func TestSetMinorUnits(t *testing.T) {
+	defer SetMinorUnits(2)
+
+	if err := SetMinorUnits(3); err != nil {
+		t.Fatalf("failed %s", err)
+	}
+
+	a, err := ParseAmount("1.234")
+	if err != nil {
+		t.Fatalf("failed %s", err)
+	}
+	if a != 1234 || a.String() != "1.234" {
+		t.Errorf("got %d (%s) and should be 1234 (1.234)", a, a)
+	}
+
+	if err = SetMinorUnits(0); err != nil {
+		t.Fatalf("failed %s", err)
+	}
+	if _, err = ParseAmount("1.5"); err == nil {
+		t.Errorf("decimals should fail without minor units")
+	}
+	if a, _ = ParseAmount("15"); a.String() != "15" {
+		t.Errorf("got %s and should be 15", a)
+	}
+
+	if err = SetMinorUnits(-1); err == nil {
+		t.Errorf("negative minor units should fail")
+	}
+}
+
+// amount parses a literal amount for test cases
+func amount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Budget is a monthly spending limit for the transactions of a category
+// or whose name matches a pattern
+type Budget struct {
+	Kind  string // cat or name
+	Match string // category or name pattern (see path.Match)
+	Limit Amount // in the base currency
+}
+
+// BudgetStatus is how a budget is doing in the current month
+type BudgetStatus struct {
+	Budget
+	Spent     Amount
+	Remaining Amount
+	Percent   float64 // of the limit spent
+	Over      bool
+}
+
+func ProcessBudget(in []string) (Budget, error) {
+	/*
+	 * bg    <cat|name>  <category|pattern>  <limit>
+	 * bg    cat         groceries           300
+	 * bg    name        "uber*"             50
+	 */
+	if len(in) < 4 {
+		return Budget{}, fmt.Errorf("process budget: missing arguments")
+	}
+
+	kind := in[1]
+	match := in[2]
+
+	switch kind {
+	case "cat":
+		if match == "" {
+			return Budget{}, fmt.Errorf("process budget: empty category")
+		}
+	case "name":
+		if _, err := path.Match(match, ""); err != nil {
+			return Budget{}, fmt.Errorf("process budget: %s", err)
+		}
+	default:
+		return Budget{}, fmt.Errorf("process budget: %q should be cat or name", kind)
+	}
+
+	limit, err := ParseAmount(in[3])
+	if err != nil {
+		return Budget{}, fmt.Errorf("process budget: %s", err)
+	}
+	if limit <= 0 {
+		return Budget{}, fmt.Errorf("process budget: limit should be greater than 0")
+	}
+
+	return Budget{kind, match, limit}, nil
+}
+
+// FindBudget looks for the budget set on the same category or pattern
+func FindBudget(b Budget, budgets []Budget) int {
+	for i, other := range budgets {
+		if other.Kind == b.Kind && other.Match == b.Match {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (b Budget) matches(tr Transaction) bool {
+	if b.Kind == "cat" {
+		return tr.Category == b.Match
+	}
+
+	ok, _ := path.Match(b.Match, tr.Name)
+	return ok
+}
+
+// buildBudgets adds up what was spent on each budget in the month of now,
+// convert takes the amounts to the base currency
+func buildBudgets(budgets []Budget, transactions []Transaction, now time.Time, convert func(Transaction) (Amount, bool)) (status []BudgetStatus) {
+	for _, b := range budgets {
+		bs := BudgetStatus{Budget: b}
+
+		for _, tr := range transactions {
+			if !inMonth(tr.Date, now) || !b.matches(tr) {
+				continue
+			}
+
+			// income on a budget (refunds) gives back what was spent
+			if amount, ok := convert(tr); ok {
+				bs.Spent -= amount
+			}
+		}
+
+		bs.Remaining = b.Limit - bs.Spent
+		bs.Percent = float64(bs.Spent) * 100 / float64(b.Limit)
+		bs.Over = bs.Spent > b.Limit
+
+		status = append(status, bs)
+	}
+
+	return
+}
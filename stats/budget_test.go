@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessBudget(t *testing.T) {
+	cases := []struct {
+		Input   []string
+		Output  Budget
+		Success bool
+	}{
+		{[]string{"bg", "cat", "groceries", "300"}, Budget{"cat", "groceries", amount("300")}, true},
+		{[]string{"bg", "name", "uber*", "50.5"}, Budget{"name", "uber*", amount("50.5")}, true},
+		{[]string{"bg", "name", "[", "50"}, Budget{}, false},
+		{[]string{"bg", "tag", "food", "50"}, Budget{}, false},
+		{[]string{"bg", "cat", "", "50"}, Budget{}, false},
+		{[]string{"bg", "cat", "food", "-50"}, Budget{}, false},
+		{[]string{"bg", "cat", "food"}, Budget{}, false},
+	}
+
+	for i, c := range cases {
+		b, err := ProcessBudget(c.Input)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+		if !c.Success {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+		if b != c.Output {
+			t.Errorf("%d: got %+v and should be %+v", i, b, c.Output)
+		}
+	}
+}
+
+func TestBuildStatsBudgets(t *testing.T) {
+	now := time.Now()
+	lastMonth := now.AddDate(0, -1, -now.Day()+1)
+
+	budgets := []Budget{
+		{"cat", "groceries", amount("100")},
+		{"name", "uber*", amount("20")},
+		{"cat", "fun", amount("50")},
+	}
+	trs := []Transaction{
+		{0, "market", "", now, amount("-60"), Attrs{Category: "groceries"}},
+		{1, "market", "", now, amount("-15.5"), Attrs{Category: "groceries"}},
+		{2, "market", "", lastMonth, amount("-90"), Attrs{Category: "groceries"}},
+		{3, "uber eats", "", now, amount("-18"), Attrs{}},
+		{4, "uber", "", now, amount("-7"), Attrs{Category: "transport"}},
+		{5, "market refund", "", now, amount("5.5"), Attrs{Category: "groceries"}},
+	}
+
+	s := BuildStats(trs, nil, nil, nil, budgets, Settings{})
+
+	expected := []struct {
+		Spent     Amount
+		Remaining Amount
+		Percent   float64
+		Over      bool
+	}{
+		{amount("70"), amount("30"), 70, false},
+		{amount("25"), amount("-5"), 125, true},
+		{0, amount("50"), 0, false},
+	}
+
+	if len(s.Budgets) != len(expected) {
+		t.Fatalf("got %d budgets and should be %d", len(s.Budgets), len(expected))
+	}
+
+	for i, e := range expected {
+		b := s.Budgets[i]
+		if b.Budget != budgets[i] {
+			t.Errorf("%d: budget is %+v and should be %+v", i, b.Budget, budgets[i])
+		}
+		if b.Spent != e.Spent {
+			t.Errorf("%d: spent is %s and should be %s", i, b.Spent, e.Spent)
+		}
+		if b.Remaining != e.Remaining {
+			t.Errorf("%d: remaining is %s and should be %s", i, b.Remaining, e.Remaining)
+		}
+		if b.Percent != e.Percent {
+			t.Errorf("%d: percent is %f and should be %f", i, b.Percent, e.Percent)
+		}
+		if b.Over != e.Over {
+			t.Errorf("%d: over is %t and should be %t", i, b.Over, e.Over)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the ledger and the scheduler, so it can be
+// something else than the real one
+type Clock interface {
+	Now() time.Time
+	// NewTimer sends the time on the channel once d has passed, the
+	// returned function stops it
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// RealClock is the time of the system
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// VirtualClock only moves when it is told to, timers fire as soon as the
+// clock goes past their deadline
+type VirtualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiting []*virtualTimer
+}
+
+type virtualTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func NewVirtualClock(now time.Time) *VirtualClock {
+	return &VirtualClock{now: now}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *VirtualClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &virtualTimer{c.now.Add(d), make(chan time.Time, 1)}
+
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+
+	c.waiting = append(c.waiting, t)
+
+	stop := func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, w := range c.waiting {
+			if w == t {
+				c.waiting = append(c.waiting[:i], c.waiting[i+1:]...)
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return t.c, stop
+}
+
+// Advance moves the clock forward by d
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to now, which can't be before its current time
+func (c *VirtualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.now) {
+		c.set(now)
+	}
+}
+
+// c.mu must be held
+func (c *VirtualClock) set(now time.Time) {
+	c.now = now
+
+	waiting := c.waiting[:0]
+	for _, t := range c.waiting {
+		if t.deadline.After(now) {
+			waiting = append(waiting, t)
+			continue
+		}
+		t.c <- now
+	}
+	c.waiting = waiting
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	c0, _ := clock.NewTimer(time.Hour)
+	c1, stop1 := clock.NewTimer(2 * time.Hour)
+	c2, _ := clock.NewTimer(0)
+
+	select {
+	case <-c2:
+	default:
+		t.Errorf("timer without duration didn't fire")
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case <-c0:
+		t.Errorf("timer fired before its deadline")
+	default:
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case now := <-c0:
+		if !now.Equal(start.Add(time.Hour)) {
+			t.Errorf("fired at %s", now)
+		}
+	default:
+		t.Errorf("timer didn't fire at its deadline")
+	}
+
+	if !stop1() {
+		t.Errorf("stop should have found the timer")
+	}
+	clock.Advance(24 * time.Hour)
+	select {
+	case <-c1:
+		t.Errorf("stopped timer fired")
+	default:
+	}
+
+	// the clock never goes back
+	clock.Set(start)
+	if !clock.Now().Equal(start.Add(25 * time.Hour)) {
+		t.Errorf("clock is at %s", clock.Now())
+	}
+}
+
+func TestSchedulerVirtualClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	s := NewScheduler(clock)
+	defer s.Stop()
+
+	s.Add(0, start.AddDate(0, 0, 2))
+	s.Add(1, start.AddDate(0, 0, 1))
+
+	select {
+	case timer := <-s.C:
+		t.Fatalf("timer %d fired before the clock moved", timer.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(72 * time.Hour)
+
+	for _, id := range []uint{1, 0} {
+		select {
+		case timer := <-s.C:
+			if timer.Id != id {
+				t.Fatalf("got %d and should be %d", timer.Id, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout!")
+		}
+	}
+}
+
+// a whole year of a household, a day at a time
+func TestSimulateYear(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	s := NewScheduler(clock)
+	defer s.Stop()
+
+	events := []Event{
+		event("ev", "salary", "", "2020-01-05", "-1", "0,1,0", "2000"),
+		event("ev", "rent", "", "2020-01-01", "-1", "0,1,0", "-800"),
+		event("ev", "groceries", "", "2020-01-03", "-1", "0,0,7", "-60.25"),
+		event("ev", "insurance", "", "2020-03-01", "4", "0,3,0", "-120"),
+	}
+	for i := range events {
+		events[i].Id = uint(i)
+		s.Add(events[i].Id, events[i].Date)
+	}
+
+	var transactions []Transaction
+
+	for day := 0; day < 366; day++ {
+		clock.Advance(24 * time.Hour)
+
+		for _, timer := range s.Due(clock.Now()) {
+			ev := &events[timer.Id]
+			transactions = append(transactions, Transaction{
+				uint(len(transactions)),
+				ev.Name,
+				ev.Description,
+				timer.Date,
+				ev.Amount,
+				ev.Attrs,
+			})
+
+			Advance(ev)
+			if ev.Times != 0 {
+				s.Add(ev.Id, ev.Date)
+			}
+		}
+	}
+
+	// 12 salaries, 13 rents (2020-01-01 and 2021-01-01), 53 weeks of
+	// groceries and 4 insurance payments
+	if len(transactions) != 12+13+53+4 {
+		t.Errorf("got %d transactions", len(transactions))
+	}
+
+	for i := 1; i < len(transactions); i++ {
+		if transactions[i].Date.Before(transactions[i-1].Date) {
+			t.Fatalf("transaction %d is out of order", i)
+		}
+	}
+
+	if events[3].Times != 0 {
+		t.Errorf("insurance still has %d payments", events[3].Times)
+	}
+
+	fired := make(map[uint]bool)
+	for _, tr := range transactions {
+		fired[tr.Id] = true
+	}
+	st := BuildStats(transactions, fired, events, nil, nil, Settings{Clock: clock})
+
+	expected := amount("24000") - amount("10400") - 53*amount("60.25") - amount("480")
+	if st.Treasury.Total != expected {
+		t.Errorf("treasury is %s and should be %s", st.Treasury.Total, expected)
+	}
+
+	// the month of the virtual clock is January 2021, rent and groceries
+	// were paid on its first day and the salary and four more weeks of
+	// groceries are to come
+	if st.Income.Total != amount("2000") || st.Expenses.Total != amount("-800")-5*amount("60.25") {
+		t.Errorf("income is %s and expenses are %s", st.Income.Total, st.Expenses.Total)
+	}
+}
@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func ProcessTarget(in []string) (kind string, id uint, err error) {
+	/*
+	 * <cmd>  <tr|ev>  <id>
+	 * rm     tr       3
+	 */
+	if len(in) < 3 {
+		return "", 0, fmt.Errorf("%s: missing arguments", in[0])
+	}
+
+	kind = in[1]
+	if kind != "tr" && kind != "ev" {
+		return "", 0, fmt.Errorf("%s: %q should be tr or ev", in[0], kind)
+	}
+
+	n, err := strconv.ParseUint(in[2], 10, 0)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %s", in[0], err)
+	}
+
+	return kind, uint(n), nil
+}
+
+// EditTransaction returns the transaction with the fields given as
+// <field>=<value> arguments replaced
+func EditTransaction(tr Transaction, in []string) (Transaction, error) {
+	/*
+	 * ed  tr  <id>  [name=<name>] [desc=<description>] [date=<date>] [amount=<amount>] [<attribute>=<value>]...
+	 * ed  tr  3     amount=20.5   cat=groceries
+	 */
+	if len(in) == 0 {
+		return tr, fmt.Errorf("edit transaction: nothing to edit")
+	}
+
+	// attributes are copied so tags are not shared with the original
+	tr.Tags = append([]string(nil), tr.Tags...)
+
+	for _, arg := range in {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return tr, fmt.Errorf("edit transaction: %s", err)
+		}
+
+		if err = editCommon(&tr.Name, &tr.Description, &tr.Date, &tr.Amount, &tr.Attrs, key, value); err != nil {
+			return tr, fmt.Errorf("edit transaction: %s", err)
+		}
+	}
+
+	return tr, nil
+}
+
+// EditEvent returns the event with the fields given as <field>=<value>
+// arguments replaced, besides the fields of a transaction an event also
+// takes times and step
+func EditEvent(ev Event, in []string) (Event, error) {
+	/*
+	 * ed  ev  <id>  [times=<times>] [step=<year>,<month>,<day>] [<transaction field>=<value>]...
+	 * ed  ev  1     times=-1        step=0,1,0
+	 */
+	if len(in) == 0 {
+		return ev, fmt.Errorf("edit event: nothing to edit")
+	}
+
+	ev.Tags = append([]string(nil), ev.Tags...)
+
+	// the date of an event that ran out is the occurrence it fired last
+	ranOut := ev.Times == 0
+	dated := false
+
+	for _, arg := range in {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return ev, fmt.Errorf("edit event: %s", err)
+		}
+
+		switch key {
+		case "times":
+			times, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return ev, fmt.Errorf("edit event: %s", err)
+			}
+			if times == 0 {
+				return ev, fmt.Errorf("edit event: times can't be 0")
+			}
+			ev.Times = int(times)
+		case "step":
+			if ev.Step, err = parseStep(value); err != nil {
+				return ev, fmt.Errorf("edit event: %s", err)
+			}
+		default:
+			if err = editCommon(&ev.Name, &ev.Description, &ev.Date, &ev.Amount, &ev.Attrs, key, value); err != nil {
+				return ev, fmt.Errorf("edit event: %s", err)
+			}
+			dated = dated || key == "date"
+		}
+	}
+
+	// given more times it fires from the occurrence after the last one,
+	// unless it was given a new date
+	if ranOut && ev.Times != 0 && !dated {
+		if ev.Step[0] == 0 && ev.Step[1] == 0 && ev.Step[2] == 0 {
+			return ev, fmt.Errorf("edit event: the event ran out, it needs a date or a step to fire again")
+		}
+		ev.Date = ev.Date.AddDate(ev.Step[0], ev.Step[1], ev.Step[2])
+	}
+
+	// an event that ran out keeps what it has, there is nothing to repeat
+	if (ev.Times > 1 || ev.Times < 0) && ev.Step[0] == 0 && ev.Step[1] == 0 && ev.Step[2] == 0 {
+		return ev, fmt.Errorf("one of the values on steps should be greater than 0")
+	}
+
+	return ev, nil
+}
+
+// fields transactions and events have in common
+func editCommon(name, description *string, date *time.Time, amount *Amount, attrs *Attrs, key, value string) (err error) {
+	switch key {
+	case "name":
+		*name = value
+	case "desc":
+		*description = value
+	case "date":
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return err
+		}
+		*date = d
+	case "amount":
+		a, err := ParseAmount(value)
+		if err != nil {
+			return err
+		}
+		*amount = a
+	default:
+		return setAttr(attrs, key, value)
+	}
+
+	return
+}
@@ -0,0 +1,174 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProcessTarget(t *testing.T) {
+	cases := []struct {
+		Input   []string
+		Kind    string
+		Id      uint
+		Success bool
+	}{
+		{[]string{"rm", "tr", "3"}, "tr", 3, true},
+		{[]string{"ed", "ev", "0", "name=foo"}, "ev", 0, true},
+		{[]string{"rm", "ac", "3"}, "", 0, false},
+		{[]string{"rm", "tr", "-1"}, "", 0, false},
+		{[]string{"rm", "tr"}, "", 0, false},
+	}
+
+	for i, c := range cases {
+		kind, id, err := ProcessTarget(c.Input)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+		if !c.Success {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+		if kind != c.Kind || id != c.Id {
+			t.Errorf("%d: got %s %d and should be %s %d", i, kind, id, c.Kind, c.Id)
+		}
+	}
+}
+
+func TestEditTransaction(t *testing.T) {
+	tr := Transaction{
+		4,
+		"foo",
+		"bar",
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		amount("10"),
+		Attrs{Tags: []string{"a"}},
+	}
+
+	edited, err := EditTransaction(tr, []string{
+		"name=market",
+		"desc=weekly shop",
+		"date=2020-02-03",
+		"amount=-20.5",
+		"cat=groceries",
+		"tags=b,c",
+	})
+	if err != nil {
+		t.Fatalf("failed %s", err)
+	}
+
+	expected := Transaction{
+		4,
+		"market",
+		"weekly shop",
+		time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+		amount("-20.5"),
+		Attrs{Category: "groceries", Tags: []string{"b", "c"}},
+	}
+	if !reflect.DeepEqual(edited, expected) {
+		t.Errorf("got %+v and should be %+v", edited, expected)
+	}
+
+	// the original keeps its values
+	if tr.Name != "foo" || tr.Tags[0] != "a" {
+		t.Errorf("original transaction was modified: %+v", tr)
+	}
+
+	bad := [][]string{
+		{},
+		{"amount=abc"},
+		{"date=yesterday"},
+		{"times=2"},
+		{"name"},
+	}
+	for i, in := range bad {
+		if _, err := EditTransaction(tr, in); err == nil {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+}
+
+func TestEditEvent(t *testing.T) {
+	ev := Event{
+		1,
+		"rent",
+		"",
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		1,
+		[3]int{0, 0, 0},
+		amount("-500"),
+		Attrs{},
+		Active,
+	}
+
+	edited, err := EditEvent(ev, []string{"times=-1", "step=0,1,0", "amount=-550"})
+	if err != nil {
+		t.Fatalf("failed %s", err)
+	}
+	if edited.Times != -1 || edited.Step != [3]int{0, 1, 0} || edited.Amount != amount("-550") {
+		t.Errorf("got %+v", edited)
+	}
+
+	bad := [][]string{
+		{"times=0"},
+		{"times=3"},
+		{"step=0,0,0"},
+		{"step=1,2,3,4"},
+		{"foo=bar"},
+	}
+	for i, in := range bad {
+		if _, err := EditEvent(ev, in); err == nil {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+
+	// an event that already fired every time can still be edited
+	ev.Times = 0
+	if edited, err = EditEvent(ev, []string{"name=old rent"}); err != nil || edited.Name != "old rent" {
+		t.Errorf("got %+v: %v", edited, err)
+	}
+	if _, err = EditEvent(ev, []string{"times=0"}); err == nil {
+		t.Errorf("times=0 should have failed")
+	}
+	if _, err = EditEvent(ev, []string{"times=1"}); err == nil {
+		t.Errorf("a ran out event without a step should need a date")
+	}
+	if edited, err = EditEvent(ev, []string{"times=1", "date=2020-06-01"}); err != nil || !edited.Date.Equal(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v: %v", edited, err)
+	}
+}
+
+// an event that ran out and is given more times doesn't fire its last
+// occurrence again
+func TestEditEventRanOut(t *testing.T) {
+	l := NewLedger(Settings{})
+	if _, err := l.Exec([]string{"ev", "rent", "", "2020-01-01", "3", "0,1,0", "-500"}); err != nil {
+		t.Fatal(err)
+	}
+	if fired := l.CatchUp(time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)); len(fired) != 3 {
+		t.Fatalf("got %v", fired)
+	}
+
+	if _, err := l.Exec([]string{"ed", "ev", "0", "times=2"}); err != nil {
+		t.Fatal(err)
+	}
+	l.CatchUp(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))
+
+	var dates []time.Time
+	for _, tr := range l.Transactions() {
+		dates = append(dates, tr.Date)
+	}
+	want := []time.Time{
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(dates, want) {
+		t.Errorf("got %v and should be %v", dates, want)
+	}
+}
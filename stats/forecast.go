@@ -0,0 +1,160 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Forecast is the balance the events will leave over the coming months,
+// starting from the treasury of today
+type Forecast struct {
+	From        time.Time
+	To          time.Time // not part of the forecast
+	Treasury    Amount    // total of today, in the base currency
+	Points      []Point   // a day or a month each
+	Lowest      Point     // the lowest the balance gets and the first day it does
+	Unconverted []string  `json:",omitempty"` // currencies without exchange rate
+}
+
+type Point struct {
+	Date    time.Time // first day it covers
+	Change  Amount    // money the occurrences in it bring or take
+	Balance Amount    // once the occurrences in it happened
+}
+
+// the longest forecast, every occurrence is walked through up to its end
+const maxForecastMonths = 120
+
+// ForecastQuery asks for the forecast of the months coming, day by day or
+// month by month
+type ForecastQuery struct {
+	Months int
+	Daily  bool
+	Out    string // file the forecast goes to instead of the reply file
+}
+
+func ProcessForecastQuery(in []string) (q ForecastQuery, err error) {
+	/*
+	 * fc  [months=<n>] [by=<day|month>] [out=<file>]
+	 * fc  months=12    by=day
+	 */
+	q.Months = 6
+
+	for _, arg := range in[1:] {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return ForecastQuery{}, fmt.Errorf("process forecast: %s", err)
+		}
+
+		switch key {
+		case "months":
+			q.Months, err = strconv.Atoi(value)
+			if err == nil && (q.Months < 1 || q.Months > maxForecastMonths) {
+				err = fmt.Errorf("months should be from 1 to %d", maxForecastMonths)
+			}
+		case "by":
+			if value != "day" && value != "month" {
+				err = fmt.Errorf("%q should be day or month", value)
+			}
+			q.Daily = value == "day"
+		case "out":
+			if value == "" {
+				err = fmt.Errorf("empty output file")
+			}
+			q.Out = value
+		default:
+			err = fmt.Errorf("%s is not an option", key)
+		}
+		if err != nil {
+			return ForecastQuery{}, fmt.Errorf("process forecast: %s", err)
+		}
+	}
+
+	return
+}
+
+// BuildForecast adds every occurrence of the active events from today to
+// the months after it to the treasury total
+func BuildForecast(Transactions []Transaction, Events []Event, settings Settings, q ForecastQuery) (f Forecast) {
+	now := settings.now()
+	f.From = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	f.To = f.From.AddDate(0, q.Months, 0)
+
+	s := BuildStats(Transactions, nil, nil, nil, nil, settings)
+	f.Treasury = s.Treasury.Total
+	unconverted := make(map[string]bool)
+	for _, currency := range s.Unconverted {
+		unconverted[currency] = true
+	}
+
+	// what every day brings or takes
+	changes := make(map[time.Time]Amount)
+	p := Period{f.From, f.To}
+
+	for _, ev := range Events {
+		for _, date := range occurrences(ev, p) {
+			amount := ev.Amount
+			if ev.Currency != "" && ev.Currency != settings.Base {
+				converted, err := settings.Rates.Convert(amount, ev.Currency, date)
+				if err != nil {
+					unconverted[ev.Currency] = true
+					continue
+				}
+				amount = converted
+			}
+			changes[date] += amount
+		}
+	}
+
+	days := make([]time.Time, 0, len(changes))
+	for d := range changes {
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	// the lowest point is found day by day whatever the points are
+	balance := f.Treasury
+	f.Lowest = Point{f.From, 0, balance}
+	for _, d := range days {
+		balance += changes[d]
+		if balance < f.Lowest.Balance {
+			f.Lowest = Point{d, changes[d], balance}
+		}
+	}
+
+	balance = f.Treasury
+	next := func(d time.Time) time.Time {
+		if q.Daily {
+			return d.AddDate(0, 0, 1)
+		}
+		return time.Date(d.Year(), d.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	i := 0
+	for d := f.From; d.Before(f.To); d = next(d) {
+		point := Point{Date: d}
+		for ; i < len(days) && days[i].Before(next(d)); i++ {
+			point.Change += changes[days[i]]
+		}
+		balance += point.Change
+		point.Balance = balance
+
+		f.Points = append(f.Points, point)
+	}
+
+	for currency := range unconverted {
+		f.Unconverted = append(f.Unconverted, currency)
+	}
+	sort.Strings(f.Unconverted)
+
+	return
+}
+
+func WriteForecast(f Forecast, out *os.File) error {
+	return writeJSON(f, out)
+}
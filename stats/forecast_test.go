@@ -0,0 +1,96 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessForecastQuery(t *testing.T) {
+	cases := []struct {
+		In    []string
+		Query ForecastQuery
+		Ok    bool
+	}{
+		{[]string{"fc"}, ForecastQuery{6, false, ""}, true},
+		{[]string{"fc", "months=12", "by=day", "out=year"}, ForecastQuery{12, true, "year"}, true},
+		{[]string{"fc", "by=month"}, ForecastQuery{6, false, ""}, true},
+		{[]string{"fc", "months=0"}, ForecastQuery{}, false},
+		{[]string{"fc", "months=120"}, ForecastQuery{120, false, ""}, true},
+		{[]string{"fc", "months=121"}, ForecastQuery{}, false},
+		{[]string{"fc", "by=week"}, ForecastQuery{}, false},
+		{[]string{"fc", "from=2020-01-01"}, ForecastQuery{}, false},
+	}
+
+	for i, c := range cases {
+		q, err := ProcessForecastQuery(c.In)
+		if (err == nil) != c.Ok {
+			t.Errorf("%d: got error %v", i, err)
+			continue
+		}
+		if q != c.Query {
+			t.Errorf("%d: got %+v and should be %+v", i, q, c.Query)
+		}
+	}
+}
+
+func TestBuildForecast(t *testing.T) {
+	rates, err := LoadRates(strings.NewReader("2020-01-01 USD 0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := Settings{Base: "EUR", Rates: rates, Clock: NewVirtualClock(day(2020, 1, 15))}
+
+	trs := []Transaction{
+		{0, "savings", "", day(2020, 1, 1), amount("1000"), Attrs{}},
+	}
+	evs := []Event{
+		event("ev", "rent", "", "2020-02-01", "-1", "0,1,0", "-800"),
+		{1, "salary", "", day(2020, 2, 10), 2, [3]int{0, 1, 0}, amount("1000"), Attrs{Currency: "USD"}, Active},
+		{2, "yen", "", day(2020, 1, 20), 1, [3]int{}, amount("-1"), Attrs{Currency: "JPY"}, Active},
+		{3, "paused", "", day(2020, 1, 20), 1, [3]int{}, amount("-5000"), Attrs{}, Paused},
+	}
+
+	f := BuildForecast(trs, evs, settings, ForecastQuery{Months: 3})
+
+	if !f.From.Equal(day(2020, 1, 15)) || !f.To.Equal(day(2020, 4, 15)) || f.Treasury != amount("1000") {
+		t.Errorf("got from %s to %s with %s", f.From, f.To, f.Treasury)
+	}
+
+	// rent falls on february, march and april, salary twice
+	months := []Point{
+		{day(2020, 1, 15), 0, amount("1000")},
+		{day(2020, 2, 1), amount("-300"), amount("700")},
+		{day(2020, 3, 1), amount("-300"), amount("400")},
+		{day(2020, 4, 1), amount("-800"), amount("-400")},
+	}
+	if len(f.Points) != len(months) {
+		t.Fatalf("got %+v and should be %+v", f.Points, months)
+	}
+	for i, p := range months {
+		if !f.Points[i].Date.Equal(p.Date) || f.Points[i].Change != p.Change || f.Points[i].Balance != p.Balance {
+			t.Errorf("%d: got %+v and should be %+v", i, f.Points[i], p)
+		}
+	}
+
+	if !f.Lowest.Date.Equal(day(2020, 4, 1)) || f.Lowest.Balance != amount("-400") {
+		t.Errorf("lowest is %+v", f.Lowest)
+	}
+	if len(f.Unconverted) != 1 || f.Unconverted[0] != "JPY" {
+		t.Errorf("unconverted are %v", f.Unconverted)
+	}
+
+	// days show when within the month the balance dips
+	f = BuildForecast(trs, evs, settings, ForecastQuery{Months: 1, Daily: true})
+	if len(f.Points) != 31 {
+		t.Fatalf("got %d days", len(f.Points))
+	}
+	if p := f.Points[17]; !p.Date.Equal(day(2020, 2, 1)) || p.Change != amount("-800") || p.Balance != amount("200") {
+		t.Errorf("first of february is %+v", p)
+	}
+	if p := f.Points[30]; !p.Date.Equal(day(2020, 2, 14)) || p.Balance != amount("700") {
+		t.Errorf("last day is %+v", p)
+	}
+	if !f.Lowest.Date.Equal(day(2020, 2, 1)) || f.Lowest.Balance != amount("200") {
+		t.Errorf("lowest is %+v", f.Lowest)
+	}
+}
@@ -0,0 +1,464 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ledger holds the transactions, events, accounts and budgets of a
+// household and hands out the ids of its transactions and events. It is
+// safe for concurrent use.
+type Ledger struct {
+	mu           sync.RWMutex
+	transactions []Transaction
+	events       []Event
+	accounts     []Account
+	budgets      []Budget
+	trIndex      uint
+	evIndex      uint
+	settings     Settings
+	fired        map[uint]bool // ids of the transactions events generated
+}
+
+func NewLedger(settings Settings) *Ledger {
+	return &Ledger{
+		transactions: make([]Transaction, 0, 5),
+		events:       make([]Event, 0, 5),
+		settings:     settings,
+		fired:        make(map[uint]bool),
+	}
+}
+
+func (l *Ledger) SetSettings(settings Settings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.settings = settings
+}
+
+// AddTransaction gives the transaction the next id and adds it
+func (l *Ledger) AddTransaction(tr Transaction) Transaction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.addTransaction(tr)
+}
+
+func (l *Ledger) addTransaction(tr Transaction) Transaction {
+	tr.Id = l.trIndex
+	l.trIndex++
+
+	l.transactions = append(l.transactions, tr)
+
+	return tr
+}
+
+// AddEvent gives the event the next id and adds it
+func (l *Ledger) AddEvent(ev Event) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.addEvent(ev)
+}
+
+func (l *Ledger) addEvent(ev Event) Event {
+	ev.Id = l.evIndex
+	l.evIndex++
+
+	l.events = append(l.events, ev)
+
+	return ev
+}
+
+// Result tells what a command did to the ledger
+type Result struct {
+	// the transaction or event the command created or changed, empty for
+	// other commands
+	Kind string
+	Id   uint
+	// events whose timer has to be set up again
+	Changed []uint
+}
+
+// Exec applies a parsed command to the ledger
+func (l *Ledger) Exec(parsed []string) (res Result, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch parsed[0] {
+	case "tr":
+		tr, err := ProcessTransaction(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		if err = l.checkAccount(tr.Account); err != nil {
+			return Result{}, err
+		}
+		if i := l.findDuplicate(tr); i >= 0 {
+			return Result{}, fmt.Errorf("%w of transaction %d", ErrDuplicate, l.transactions[i].Id)
+		}
+
+		tr = l.addTransaction(tr)
+		res = Result{"tr", tr.Id, nil}
+	case "ev":
+		ev, err := ProcessEvent(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		if err = l.checkAccount(ev.Account); err != nil {
+			return Result{}, err
+		}
+
+		ev = l.addEvent(ev)
+		res = Result{"ev", ev.Id, []uint{ev.Id}}
+	case "ac":
+		ac, err := ProcessAccount(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		if FindAccount(ac.Name, l.accounts) >= 0 {
+			return Result{}, fmt.Errorf("%w: %s", ErrAccountExists, ac.Name)
+		}
+
+		l.accounts = append(l.accounts, ac)
+	case "bg":
+		b, err := ProcessBudget(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+
+		// setting a budget again changes its limit
+		if i := FindBudget(b, l.budgets); i >= 0 {
+			l.budgets[i] = b
+		} else {
+			l.budgets = append(l.budgets, b)
+		}
+	case "rm":
+		kind, id, err := ProcessTarget(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		res = Result{Kind: kind, Id: id}
+
+		if kind == "tr" {
+			i := findTransaction(id, l.transactions)
+			if i < 0 {
+				return Result{}, fmt.Errorf("The transaction with id %d does not exist", id)
+			}
+			l.transactions = append(l.transactions[:i], l.transactions[i+1:]...)
+		} else {
+			i := findEvent(id, l.events)
+			if i < 0 {
+				return Result{}, fmt.Errorf("The event with id %d does not exist", id)
+			}
+			l.events = append(l.events[:i], l.events[i+1:]...)
+			res.Changed = []uint{id}
+		}
+	case "ed":
+		kind, id, err := ProcessTarget(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		res = Result{Kind: kind, Id: id}
+
+		if kind == "tr" {
+			i := findTransaction(id, l.transactions)
+			if i < 0 {
+				return Result{}, fmt.Errorf("The transaction with id %d does not exist", id)
+			}
+
+			tr, err := EditTransaction(l.transactions[i], parsed[3:])
+			if err != nil {
+				return Result{}, err
+			}
+			if err = l.checkAccount(tr.Account); err != nil {
+				return Result{}, err
+			}
+
+			l.transactions[i] = tr
+		} else {
+			i := findEvent(id, l.events)
+			if i < 0 {
+				return Result{}, fmt.Errorf("The event with id %d does not exist", id)
+			}
+
+			ev, err := EditEvent(l.events[i], parsed[3:])
+			if err != nil {
+				return Result{}, err
+			}
+			if err = l.checkAccount(ev.Account); err != nil {
+				return Result{}, err
+			}
+
+			l.events[i] = ev
+			res.Changed = []uint{id}
+		}
+	case "pause", "resume", "cancel":
+		kind, id, err := ProcessTarget(parsed)
+		if err != nil {
+			return Result{}, err
+		}
+		if kind != "ev" {
+			return Result{}, fmt.Errorf("%s: only events can be stopped", parsed[0])
+		}
+
+		i := findEvent(id, l.events)
+		if i < 0 {
+			return Result{}, fmt.Errorf("The event with id %d does not exist", id)
+		}
+		ev := &l.events[i]
+
+		if ev.State == Cancelled {
+			return Result{}, fmt.Errorf("The event with id %d is cancelled", id)
+		}
+
+		switch parsed[0] {
+		case "pause":
+			ev.State = Paused
+		case "cancel":
+			ev.State = Cancelled
+		case "resume":
+			if ev.State != Paused {
+				return Result{}, fmt.Errorf("The event with id %d is not paused", id)
+			}
+
+			// what was due while paused is skipped, the command carries
+			// the time the event was resumed at so replaying it gives the
+			// same result
+			if len(parsed) < 4 {
+				return Result{}, fmt.Errorf("resume: missing date")
+			}
+			now, err := time.Parse(time.RFC3339Nano, parsed[3])
+			if err != nil {
+				return Result{}, fmt.Errorf("resume: %s", err)
+			}
+
+			Skip(ev, now)
+			ev.State = Active
+		}
+
+		res = Result{"ev", id, []uint{id}}
+	default:
+		return Result{}, fmt.Errorf("%s is not a cmd", parsed[0])
+	}
+
+	return
+}
+
+// ErrDuplicate rejects a transaction already imported, it has the reference
+// of one in the ledger with its same date and amount
+var ErrDuplicate = errors.New("duplicate")
+
+// ErrAccountExists rejects an account declared twice
+var ErrAccountExists = errors.New("the account already exists")
+
+func (l *Ledger) findDuplicate(tr Transaction) int {
+	if tr.Ref == "" {
+		return -1
+	}
+
+	for i, other := range l.transactions {
+		if other.Ref == tr.Ref && other.Date.Equal(tr.Date) && other.Amount == tr.Amount {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// entries can only be tied to declared accounts
+func (l *Ledger) checkAccount(name string) error {
+	if name != "" && FindAccount(name, l.accounts) < 0 {
+		return fmt.Errorf("The account %s does not exist", name)
+	}
+
+	return nil
+}
+
+// Fire adds the transaction generated by the occurrence of the event at
+// date and moves the event to its next date, it returns the updated event
+func (l *Ledger) Fire(id uint, date time.Time) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.fire(id, date)
+}
+
+func (l *Ledger) fire(id uint, date time.Time) (Event, error) {
+	i := findEvent(id, l.events)
+	if i < 0 {
+		return Event{}, fmt.Errorf("The event with id %d does not exist", id)
+	}
+
+	// selected event
+	ev := &l.events[i]
+
+	// build new transaction
+	tr := l.addTransaction(BuildTransaction(ev.Name, ev.Description, date, ev.Amount, ev.Attrs))
+	l.fired[tr.Id] = true
+
+	// when times reaches 0 that means the event should not keep repeating
+	// hence a new timer is only needed if times is greater than zero or
+	// negative (that means it will keep reapeating forever)
+	Advance(ev)
+
+	return *ev, nil
+}
+
+// CatchUp fires every occurrence that should have happened up to now, it
+// returns them in the order they were fired
+func (l *Ledger) CatchUp(now time.Time) (fired []Timer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.events {
+		for _, date := range Missed(l.events[i], now) {
+			l.fire(l.events[i].Id, date)
+			fired = append(fired, Timer{l.events[i].Id, date})
+		}
+	}
+
+	return
+}
+
+// Transaction returns a copy of the transaction with the id
+func (l *Ledger) Transaction(id uint) (Transaction, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	i := findTransaction(id, l.transactions)
+	if i < 0 {
+		return Transaction{}, false
+	}
+
+	return l.transactions[i], true
+}
+
+// Event returns a copy of the event with the id
+func (l *Ledger) Event(id uint) (Event, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	i := findEvent(id, l.events)
+	if i < 0 {
+		return Event{}, false
+	}
+
+	return l.events[i], true
+}
+
+// Transactions returns a copy of every transaction
+func (l *Ledger) Transactions() []Transaction {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]Transaction(nil), l.transactions...)
+}
+
+// Events returns a copy of every event
+func (l *Ledger) Events() []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]Event(nil), l.events...)
+}
+
+func (l *Ledger) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	s := BuildStats(l.transactions, l.fired, l.events, l.accounts, l.budgets, l.settings)
+	s.History = l.history(l.settings.History)
+
+	return s
+}
+
+// Forecast projects the balance over the months of the query
+func (l *Ledger) Forecast(q ForecastQuery) Forecast {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return BuildForecast(l.transactions, l.events, l.settings, q)
+}
+
+// Period returns the stats of the period, the current month if it's unset
+func (l *Ledger) Period(p Period) Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if p.IsZero() {
+		p = MonthPeriod(l.settings.now())
+	}
+
+	return BuildPeriodStats(l.transactions, l.fired, l.events, l.accounts, l.budgets, l.settings, p)
+}
+
+// history sums up the months before the current one and the current one
+func (l *Ledger) history(months int) (history []Summary) {
+	current := MonthPeriod(l.settings.now()).From
+
+	for i := months - 1; i >= 0; i-- {
+		p := MonthPeriod(current.AddDate(0, -i, 0))
+		s := BuildPeriodStats(l.transactions, l.fired, l.events, l.accounts, nil, l.settings, p)
+
+		history = append(history, Summary{
+			p.From.Format("2006-01"),
+			s.Treasury.Total,
+			s.Income.Total,
+			s.Expenses.Total,
+			s.Balance,
+		})
+	}
+
+	return
+}
+
+// Months returns every month with transactions plus the current one, in
+// order
+func (l *Ledger) Months() []time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	seen := make(map[time.Time]bool)
+	add := func(d time.Time) {
+		seen[time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)] = true
+	}
+
+	add(l.settings.now())
+	for _, tr := range l.transactions {
+		add(tr.Date)
+	}
+
+	months := make([]time.Time, 0, len(seen))
+	for m := range seen {
+		months = append(months, m)
+	}
+	sort.Slice(months, func(i, j int) bool {
+		return months[i].Before(months[j])
+	})
+
+	return months
+}
+
+func findTransaction(id uint, transactions []Transaction) int {
+	for i, tr := range transactions {
+		if tr.Id == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func findEvent(id uint, events []Event) int {
+	for i, ev := range events {
+		if ev.Id == id {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLedgerExec(t *testing.T) {
+	l := NewLedger(Settings{})
+
+	cmds := [][]string{
+		{"tr", "foo", "bar", "2020-01-01", "100"},
+		{"tr", "bar", "foo", "2020-01-02", "-30"},
+		{"ev", "rent", "", "2020-01-05", "-1", "0,1,0", "-500"},
+		{"ac", "bank", "checking"},
+		{"ed", "tr", "1", "amount=-40", "acc=bank"},
+		{"rm", "tr", "0"},
+		{"tr", "baz", "", "2020-01-03", "10"},
+		{"pause", "ev", "0"},
+	}
+	for i, cmd := range cmds {
+		if _, err := l.Exec(cmd); err != nil {
+			t.Fatalf("%d: failed %s", i, err)
+		}
+	}
+
+	trs := l.Transactions()
+	if len(trs) != 2 {
+		t.Fatalf("got %d transactions and should be 2", len(trs))
+	}
+	// removed ids are not given again
+	if trs[0].Id != 1 || trs[1].Id != 2 {
+		t.Errorf("got ids %d, %d and should be 1, 2", trs[0].Id, trs[1].Id)
+	}
+	if trs[0].Amount != amount("-40") || trs[0].Account != "bank" {
+		t.Errorf("edit not applied: %+v", trs[0])
+	}
+
+	res, err := l.Exec([]string{"ev", "bonus", "", "2020-12-20", "1", "0,0,0", "200"})
+	if err != nil || res.Kind != "ev" || res.Id != 1 || len(res.Changed) != 1 {
+		t.Errorf("got %+v %v", res, err)
+	}
+	res, _ = l.Exec([]string{"ed", "tr", "2", "name=qux"})
+	if res.Kind != "tr" || res.Id != 2 || len(res.Changed) != 0 {
+		t.Errorf("got %+v", res)
+	}
+
+	ev, ok := l.Event(0)
+	if !ok || ev.State != Paused {
+		t.Errorf("got %+v and should be paused", ev)
+	}
+
+	bad := [][]string{
+		{"rm", "tr", "0"},
+		{"tr", "x", "x", "2020-01-01", "1", "acc=nope"},
+		{"resume", "ev", "0"},
+		{"foo"},
+	}
+	for i, cmd := range bad {
+		if _, err := l.Exec(cmd); err == nil {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+}
+
+func TestLedgerFire(t *testing.T) {
+	l := NewLedger(Settings{})
+	l.AddTransaction(BuildTransaction("foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), amount("1"), Attrs{}))
+	ev := l.AddEvent(BuildEvent("rent", "", time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC), 3, [3]int{0, 1, 0}, amount("-500"), Attrs{}))
+
+	fired := l.CatchUp(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC))
+	if len(fired) != 2 {
+		t.Fatalf("got %d occurrences and should be 2", len(fired))
+	}
+
+	next, err := l.Fire(ev.Id, fired[1].Date.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Times != 0 {
+		t.Errorf("got times %d and should be 0", next.Times)
+	}
+
+	trs := l.Transactions()
+	if len(trs) != 4 {
+		t.Fatalf("got %d transactions and should be 4", len(trs))
+	}
+	for i, tr := range trs {
+		if tr.Id != uint(i) {
+			t.Errorf("%d: got id %d", i, tr.Id)
+		}
+	}
+
+	if _, err := l.Fire(10, time.Now()); err == nil {
+		t.Errorf("firing an unknown event should fail")
+	}
+}
+
+func TestLedgerConcurrent(t *testing.T) {
+	a := NewLedger(Settings{})
+	b := NewLedger(Settings{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			a.Exec([]string{"tr", fmt.Sprint("a", i), "", "2020-01-01", "1"})
+			a.Stats()
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			b.Exec([]string{"tr", fmt.Sprint("b", i), "", "2020-01-01", "1"})
+			a.Transactions()
+		}(i)
+	}
+	wg.Wait()
+
+	// each ledger hands out its own ids
+	for _, l := range []*Ledger{a, b} {
+		seen := make(map[uint]bool)
+		for _, tr := range l.Transactions() {
+			if seen[tr.Id] || tr.Id >= 50 {
+				t.Errorf("id %d given twice or out of range", tr.Id)
+			}
+			seen[tr.Id] = true
+		}
+		if len(seen) != 50 {
+			t.Errorf("got %d transactions and should be 50", len(seen))
+		}
+	}
+}
+
+func TestLedgerDuplicate(t *testing.T) {
+	l := NewLedger(Settings{})
+
+	cases := []struct {
+		Input     []string
+		Duplicate bool
+	}{
+		{[]string{"tr", "foo", "", "2020-01-01", "10", "ref=a1"}, false},
+		{[]string{"tr", "foo", "", "2020-01-01", "10", "ref=a1"}, true},
+		// the same reference on another day or for another amount is another
+		// transaction
+		{[]string{"tr", "foo", "", "2020-01-02", "10", "ref=a1"}, false},
+		{[]string{"tr", "foo", "", "2020-01-01", "11", "ref=a1"}, false},
+		{[]string{"tr", "foo", "", "2020-01-01", "10", "ref=a2"}, false},
+		{[]string{"tr", "foo", "", "2020-01-01", "10"}, false},
+		{[]string{"tr", "foo", "", "2020-01-01", "10"}, false},
+	}
+
+	for i, c := range cases {
+		_, err := l.Exec(c.Input)
+		if c.Duplicate != errors.Is(err, ErrDuplicate) {
+			t.Errorf("%d: got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a span of days stats are built for, To isn't part of it
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// Summary is a month of the history in the stats
+type Summary struct {
+	Month    string // yyyy-mm
+	Treasury Amount
+	Income   Amount
+	Expenses Amount
+	Balance  Amount
+}
+
+// StatsQuery asks for the stats of a period, the current month if the
+// period is left unset
+type StatsQuery struct {
+	Period Period
+	Out    string // file the stats go to instead of the reply file
+}
+
+func (p Period) Contains(d time.Time) bool {
+	return !d.Before(p.From) && d.Before(p.To)
+}
+
+func (p Period) IsZero() bool {
+	return p.From.IsZero() && p.To.IsZero()
+}
+
+func MonthPeriod(d time.Time) Period {
+	from := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Period{from, from.AddDate(0, 1, 0)}
+}
+
+func QuarterPeriod(d time.Time) Period {
+	from := time.Date(d.Year(), (d.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	return Period{from, from.AddDate(0, 3, 0)}
+}
+
+func YearPeriod(d time.Time) Period {
+	from := time.Date(d.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	return Period{from, from.AddDate(1, 0, 0)}
+}
+
+/*
+* yyyy      a year
+* yyyy-qN   a quarter
+* yyyy-mm   a month
+ */
+func ParsePeriod(s string) (Period, error) {
+	if d, err := time.Parse("2006", s); err == nil {
+		return YearPeriod(d), nil
+	}
+	if d, err := time.Parse("2006-01", s); err == nil {
+		return MonthPeriod(d), nil
+	}
+
+	if i := strings.IndexAny(s, "qQ"); i > 0 && s[i-1] == '-' {
+		year, err := time.Parse("2006", s[:i-1])
+		q, qerr := strconv.Atoi(s[i+1:])
+		if err == nil && qerr == nil && q >= 1 && q <= 4 {
+			return QuarterPeriod(year.AddDate(0, 3*(q-1), 0)), nil
+		}
+	}
+
+	return Period{}, fmt.Errorf("%q is not a year, quarter or month", s)
+}
+
+func ProcessStatsQuery(in []string) (q StatsQuery, err error) {
+	/*
+	 * st  [period=<yyyy|yyyy-qN|yyyy-mm>] [from=<date>] [to=<date>] [out=<file>]
+	 * st  period=2020-q1
+	 * st  from=2020-01-15 to=2020-02-14
+	 */
+	var from, to time.Time
+	period := false
+
+	for _, arg := range in[1:] {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return StatsQuery{}, fmt.Errorf("process stats query: %s", err)
+		}
+
+		switch key {
+		case "period":
+			q.Period, err = ParsePeriod(value)
+			period = true
+		case "from":
+			from, err = time.Parse("2006-01-02", value)
+		case "to":
+			to, err = time.Parse("2006-01-02", value)
+		case "out":
+			if value == "" {
+				err = fmt.Errorf("empty output file")
+			}
+			q.Out = value
+		default:
+			err = fmt.Errorf("%s is not an option", key)
+		}
+		if err != nil {
+			return StatsQuery{}, fmt.Errorf("process stats query: %s", err)
+		}
+	}
+
+	if from.IsZero() && to.IsZero() {
+		return
+	}
+
+	switch {
+	case period:
+		return StatsQuery{}, fmt.Errorf("process stats query: period can't be used with from and to")
+	case from.IsZero() || to.IsZero():
+		return StatsQuery{}, fmt.Errorf("process stats query: from and to go together")
+	case to.Before(from):
+		return StatsQuery{}, fmt.Errorf("process stats query: %s is before %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+
+	// to is the last day of the period
+	q.Period = Period{from, to.AddDate(0, 0, 1)}
+
+	return
+}
+
+// occurrences returns the dates the event fires on inside the period
+func occurrences(ev Event, p Period) (dates []time.Time) {
+	if ev.State != Active {
+		return
+	}
+
+	for ev.Times != 0 && ev.Date.Before(p.To) {
+		if !ev.Date.Before(p.From) {
+			dates = append(dates, ev.Date)
+		}
+		Advance(&ev)
+	}
+
+	return
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParsePeriod(t *testing.T) {
+	cases := []struct {
+		In     string
+		Period Period
+		Ok     bool
+	}{
+		{"2020", Period{day(2020, 1, 1), day(2021, 1, 1)}, true},
+		{"2020-02", Period{day(2020, 2, 1), day(2020, 3, 1)}, true},
+		{"2020-q1", Period{day(2020, 1, 1), day(2020, 4, 1)}, true},
+		{"2020-Q4", Period{day(2020, 10, 1), day(2021, 1, 1)}, true},
+		{"2020-q5", Period{}, false},
+		{"2020-13", Period{}, false},
+		{"q1", Period{}, false},
+		{"", Period{}, false},
+	}
+
+	for i, c := range cases {
+		p, err := ParsePeriod(c.In)
+		if (err == nil) != c.Ok {
+			t.Errorf("%d: got error %v", i, err)
+			continue
+		}
+		if p != c.Period {
+			t.Errorf("%d: got %v and should be %v", i, p, c.Period)
+		}
+	}
+
+	if p := QuarterPeriod(day(2020, 8, 31)); p != (Period{day(2020, 7, 1), day(2020, 10, 1)}) {
+		t.Errorf("quarter of august is %v", p)
+	}
+}
+
+func TestProcessStatsQuery(t *testing.T) {
+	cases := []struct {
+		In    []string
+		Query StatsQuery
+		Ok    bool
+	}{
+		{[]string{"st"}, StatsQuery{}, true},
+		{[]string{"st", "period=2020-03", "out=march"}, StatsQuery{Period{day(2020, 3, 1), day(2020, 4, 1)}, "march"}, true},
+		{[]string{"st", "from=2020-01-15", "to=2020-02-14"}, StatsQuery{Period{day(2020, 1, 15), day(2020, 2, 15)}, ""}, true},
+		{[]string{"st", "from=2020-01-15"}, StatsQuery{}, false},
+		{[]string{"st", "from=2020-02-15", "to=2020-01-15"}, StatsQuery{}, false},
+		{[]string{"st", "period=2020", "from=2020-01-01", "to=2020-01-02"}, StatsQuery{}, false},
+		{[]string{"st", "name=foo"}, StatsQuery{}, false},
+		{[]string{"st", "out="}, StatsQuery{}, false},
+	}
+
+	for i, c := range cases {
+		q, err := ProcessStatsQuery(c.In)
+		if (err == nil) != c.Ok {
+			t.Errorf("%d: got error %v", i, err)
+			continue
+		}
+		if q != c.Query {
+			t.Errorf("%d: got %+v and should be %+v", i, q, c.Query)
+		}
+	}
+}
+
+func TestBuildPeriodStats(t *testing.T) {
+	trs := []Transaction{
+		{0, "old", "", day(2019, 12, 31), amount("-1"), Attrs{}},
+		{1, "cleaning", "", day(2020, 1, 3), amount("-20"), Attrs{}},
+		{2, "market", "", day(2020, 1, 10), amount("-30"), Attrs{Category: "food"}},
+		{3, "payroll", "", day(2020, 1, 31), amount("1000"), Attrs{}},
+		{4, "new", "", day(2020, 2, 1), amount("-2"), Attrs{}},
+	}
+	// cleaning fired on the 3rd, what's left of it is after now
+	fired := map[uint]bool{1: true}
+	evs := []Event{
+		event("ev", "cleaning", "", "2020-01-17", "-1", "0,0,14", "-20"),
+		event("ev", "bonus", "", "2020-01-20", "1", "0,0,0", "100"),
+		event("ev", "paused", "", "2020-01-05", "3", "0,0,1", "-1"),
+	}
+	evs[2].State = Paused
+	budgets := []Budget{{"cat", "food", amount("100")}}
+	settings := Settings{Clock: NewVirtualClock(day(2020, 1, 10))}
+
+	s := BuildPeriodStats(trs, fired, evs, nil, budgets, settings, MonthPeriod(day(2020, 1, 1)))
+
+	if s.Treasury.Total != amount("950") || len(s.Treasury.Entries) != 3 {
+		t.Errorf("treasury is %s with %d entries", s.Treasury.Total, len(s.Treasury.Entries))
+	}
+	// every occurrence in the month counts, fired or to come
+	if s.Expenses.Total != amount("-60") || len(s.Expenses.Entries) != 3 || !s.Expenses.Entries[2].Date.Equal(day(2020, 1, 31)) {
+		t.Errorf("expenses are %s with %+v", s.Expenses.Total, s.Expenses.Entries)
+	}
+	if s.Income.Total != amount("100") || s.Balance != amount("40") {
+		t.Errorf("income is %s and balance %s", s.Income.Total, s.Balance)
+	}
+	if len(s.Budgets) != 1 || s.Budgets[0].Spent != amount("30") {
+		t.Errorf("budgets are %+v", s.Budgets)
+	}
+	if s.Period == nil || *s.Period != MonthPeriod(day(2020, 1, 1)) {
+		t.Errorf("period is %v", s.Period)
+	}
+
+	// budgets are monthly
+	s = BuildPeriodStats(trs, fired, evs, nil, budgets, settings, Period{day(2019, 12, 31), day(2020, 1, 11)})
+	if s.Treasury.Total != amount("-51") || len(s.Budgets) != 0 {
+		t.Errorf("treasury is %s and budgets %+v", s.Treasury.Total, s.Budgets)
+	}
+	if s.Expenses.Total != amount("-20") {
+		t.Errorf("expenses are %s", s.Expenses.Total)
+	}
+}
+
+func TestLedgerHistory(t *testing.T) {
+	l := NewLedger(Settings{Clock: NewVirtualClock(day(2020, 3, 31)), History: 3})
+	l.AddTransaction(BuildTransaction("market", "", day(2020, 1, 10), amount("-30"), Attrs{}))
+	l.AddTransaction(BuildTransaction("payroll", "", day(2020, 3, 1), amount("1000"), Attrs{}))
+	l.AddEvent(BuildEvent("rent", "", day(2020, 3, 31), 1, [3]int{}, amount("-500"), Attrs{}))
+
+	// the salary of every month already fired, rent is still to come
+	l.AddEvent(event("ev", "salary", "", "2020-01-25", "-1", "0,1,0", "2000"))
+	if fired := l.CatchUp(day(2020, 3, 30)); len(fired) != 3 {
+		t.Fatalf("fired %+v", fired)
+	}
+
+	want := []Summary{
+		{"2020-01", amount("1970"), amount("2000"), 0, amount("2000")},
+		{"2020-02", amount("2000"), amount("2000"), 0, amount("2000")},
+		{"2020-03", amount("3000"), amount("2000"), amount("-500"), amount("1500")},
+	}
+
+	s := l.Stats()
+	if len(s.History) != len(want) {
+		t.Fatalf("got %+v and should be %+v", s.History, want)
+	}
+	for i := range want {
+		if s.History[i] != want[i] {
+			t.Errorf("%d: got %+v and should be %+v", i, s.History[i], want[i])
+		}
+	}
+
+	p := l.Period(Period{})
+	if p.Period == nil || *p.Period != MonthPeriod(day(2020, 3, 1)) {
+		t.Errorf("period is %v", p.Period)
+	}
+
+	// the status has the figures of the current month st has
+	if s.Income.Total != p.Income.Total || s.Expenses.Total != p.Expenses.Total || s.Balance != p.Balance {
+		t.Errorf("status has %s %s %s and the month %s %s %s", s.Income.Total, s.Expenses.Total, s.Balance, p.Income.Total, p.Expenses.Total, p.Balance)
+	}
+}
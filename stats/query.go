@@ -0,0 +1,147 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Query selects transactions and events, every filter left unset matches
+// everything
+type Query struct {
+	Type string // tr, ev or empty for both
+	Name string // shell pattern matched against the name
+	From time.Time
+	To   time.Time
+	Min  *Amount
+	Max  *Amount
+	Out  string // file the result goes to instead of the reply file
+}
+
+type QueryResult struct {
+	Transactions []Transaction
+	Events       []Event
+}
+
+func ProcessQuery(in []string) (q Query, err error) {
+	/*
+	 * q  [type=<tr|ev>] [name=<pattern>] [from=<date>] [to=<date>] [min=<amount>] [max=<amount>] [out=<file>]
+	 * q  type=tr        name=uber*       from=2020-01-01           max=-10
+	 */
+	for _, arg := range in[1:] {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return Query{}, fmt.Errorf("process query: %s", err)
+		}
+
+		if err = setFilter(&q, key, value); err != nil {
+			return Query{}, fmt.Errorf("process query: %s", err)
+		}
+	}
+
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return Query{}, fmt.Errorf("process query: %s is before %s", q.To.Format("2006-01-02"), q.From.Format("2006-01-02"))
+	}
+
+	return
+}
+
+func setFilter(q *Query, key, value string) (err error) {
+	switch key {
+	case "type":
+		if value != "tr" && value != "ev" {
+			return fmt.Errorf("%q should be tr or ev", value)
+		}
+		q.Type = value
+	case "name":
+		// the pattern is checked now so matching can't fail later
+		if _, err = path.Match(value, ""); err != nil {
+			return err
+		}
+		q.Name = value
+	case "from":
+		q.From, err = time.Parse("2006-01-02", value)
+	case "to":
+		q.To, err = time.Parse("2006-01-02", value)
+	case "min", "max":
+		a, err := ParseAmount(value)
+		if err != nil {
+			return err
+		}
+		if key == "min" {
+			q.Min = &a
+		} else {
+			q.Max = &a
+		}
+	case "out":
+		if value == "" {
+			return fmt.Errorf("empty output file")
+		}
+		q.Out = value
+	default:
+		return fmt.Errorf("%s is not a filter", key)
+	}
+
+	return
+}
+
+// Match tells if an entry with the name, date and amount passes the filters,
+// both ends of the date and amount ranges are included
+func (q Query) Match(name string, date time.Time, amount Amount) bool {
+	if q.Name != "" {
+		if ok, _ := path.Match(q.Name, name); !ok {
+			return false
+		}
+	}
+
+	if !q.From.IsZero() && date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && date.After(q.To) {
+		return false
+	}
+
+	if q.Min != nil && amount < *q.Min {
+		return false
+	}
+	if q.Max != nil && amount > *q.Max {
+		return false
+	}
+
+	return true
+}
+
+// Query returns the transactions and events that pass the filters, events
+// are matched by the date of their next occurrence
+func (l *Ledger) Query(q Query) QueryResult {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := QueryResult{
+		make([]Transaction, 0),
+		make([]Event, 0),
+	}
+
+	if q.Type != "ev" {
+		for _, tr := range l.transactions {
+			if q.Match(tr.Name, tr.Date, tr.Amount) {
+				res.Transactions = append(res.Transactions, tr)
+			}
+		}
+	}
+
+	if q.Type != "tr" {
+		for _, ev := range l.events {
+			if q.Match(ev.Name, ev.Date, ev.Amount) {
+				res.Events = append(res.Events, ev)
+			}
+		}
+	}
+
+	return res
+}
+
+func WriteQuery(res QueryResult, f *os.File) error {
+	return writeJSON(res, f)
+}
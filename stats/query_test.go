@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessQuery(t *testing.T) {
+	cases := []struct {
+		Input   []string
+		Success bool
+	}{
+		{[]string{"q"}, true},
+		{[]string{"q", "type=tr", "name=uber*", "from=2020-01-01", "to=2020-02-01", "min=-10", "max=5.5", "out=a.json"}, true},
+		{[]string{"q", "type=foo"}, false},
+		{[]string{"q", "name=["}, false},
+		{[]string{"q", "from=yesterday"}, false},
+		{[]string{"q", "min=a"}, false},
+		{[]string{"q", "from=2020-02-01", "to=2020-01-01"}, false},
+		{[]string{"q", "out="}, false},
+		{[]string{"q", "foo=bar"}, false},
+		{[]string{"q", "tr"}, false},
+	}
+
+	for i, c := range cases {
+		_, err := ProcessQuery(c.Input)
+		if err != nil && c.Success {
+			t.Errorf("%d: failed %s", i, err)
+		}
+		if err == nil && !c.Success {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+}
+
+func TestLedgerQuery(t *testing.T) {
+	l := NewLedger(Settings{})
+	cmds := [][]string{
+		{"tr", "salary", "", "2020-01-01", "1000"},
+		{"tr", "uber", "", "2020-01-10", "-12"},
+		{"tr", "uber eats", "", "2020-02-10", "-25.5"},
+		{"tr", "market", "", "2020-02-11", "-80"},
+		{"ev", "rent", "", "2020-03-01", "-1", "0,1,0", "-500"},
+	}
+	for _, cmd := range cmds {
+		if _, err := l.Exec(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		Input        []string
+		Transactions []string
+		Events       []string
+	}{
+		{[]string{"q"}, []string{"salary", "uber", "uber eats", "market"}, []string{"rent"}},
+		{[]string{"q", "type=ev"}, nil, []string{"rent"}},
+		{[]string{"q", "name=uber*"}, []string{"uber", "uber eats"}, nil},
+		{[]string{"q", "from=2020-01-10", "to=2020-02-10"}, []string{"uber", "uber eats"}, nil},
+		{[]string{"q", "type=tr", "max=-20"}, []string{"uber eats", "market"}, nil},
+		{[]string{"q", "min=-100", "max=-20"}, []string{"uber eats", "market"}, nil},
+		{[]string{"q", "from=2020-02-01", "min=0"}, nil, nil},
+	}
+
+	for i, c := range cases {
+		q, err := ProcessQuery(c.Input)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		res := l.Query(q)
+
+		var names []string
+		for _, tr := range res.Transactions {
+			names = append(names, tr.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(c.Transactions, ",") {
+			t.Errorf("%d: got transactions %v and should be %v", i, names, c.Transactions)
+		}
+
+		names = nil
+		for _, ev := range res.Events {
+			names = append(names, ev.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(c.Events, ",") {
+			t.Errorf("%d: got events %v and should be %v", i, names, c.Events)
+		}
+	}
+}
+
+func TestWriteQuery(t *testing.T) {
+	f, err := os.CreateTemp("", "reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	res := QueryResult{
+		[]Transaction{{0, "foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), amount("1.5"), Attrs{}}},
+		[]Event{},
+	}
+	// a longer answer first so truncating is checked
+	WriteQuery(QueryResult{make([]Transaction, 3), nil}, f)
+	if err = WriteQuery(res, f); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Seek(0, 0)
+	b, _ := io.ReadAll(f)
+
+	expected := `{"Transactions":[{"Id":0,"Name":"foo","Description":"","Date":"2020-01-01T00:00:00Z","Amount":1.5}],"Events":[]}`
+	if string(b) != expected {
+		t.Errorf("got %s and should be %s", b, expected)
+	}
+}
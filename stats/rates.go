@@ -0,0 +1,120 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// Rates is a table of exchange rates to the base currency. Each currency
+// can have several rates, the one in effect for a date is the latest one
+// set on or before it.
+type Rates struct {
+	rates map[string][]rate // sorted by date
+}
+
+type rate struct {
+	Date  time.Time
+	Value *big.Rat // how much of the base currency one unit is worth
+}
+
+/*
+* <date>      <currency>  <value of one unit in the base currency>
+* 2020-01-01  USD         0.91
+ */
+func LoadRates(in io.Reader) (*Rates, error) {
+	r := csv.NewReader(in)
+	r.Comma = ' '
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	rates := &Rates{make(map[string][]rate)}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rates: %s", err)
+		}
+
+		line, _ := r.FieldPos(0)
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("rates: line %d: missing arguments", line)
+		}
+
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("rates: line %d: %s", line, err)
+		}
+
+		currency, err := parseCurrency(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("rates: line %d: %s", line, err)
+		}
+
+		value, ok := new(big.Rat).SetString(record[2])
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("rates: line %d: invalid rate %q", line, record[2])
+		}
+
+		rates.rates[currency] = append(rates.rates[currency], rate{date, value})
+	}
+
+	for _, rs := range rates.rates {
+		sort.SliceStable(rs, func(i, j int) bool {
+			return rs[i].Date.Before(rs[j].Date)
+		})
+	}
+
+	return rates, nil
+}
+
+// Convert turns an amount in currency into the base currency using the
+// rate in effect at date. If there is no rate set before date the oldest
+// one is used, a currency missing from the table is an error.
+func (r *Rates) Convert(a Amount, currency string, date time.Time) (Amount, error) {
+	var rs []rate
+	if r != nil {
+		rs = r.rates[currency]
+	}
+	if len(rs) == 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+
+	// first rate after date
+	i := sort.Search(len(rs), func(i int) bool {
+		return rs[i].Date.After(date)
+	})
+	if i > 0 {
+		i--
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rs[i].Value)
+
+	return round(converted), nil
+}
+
+// round takes a number of minor units to the nearest integer, halves go
+// away from zero
+func round(r *big.Rat) Amount {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m.Lsh(m, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	return Amount(q.Int64())
+}
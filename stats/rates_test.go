@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const ratesTable = `# date       currency  rate
+2020-02-01 usd 0.90
+2020-01-01   USD  0.80
+2020-01-01 GBP 1.15
+`
+
+func TestLoadRates(t *testing.T) {
+	bad := []string{
+		"2020-01-01 USD",
+		"01/01/2020 USD 0.9",
+		"2020-01-01 DOLLAR 0.9",
+		"2020-01-01 USD abc",
+		"2020-01-01 USD -1",
+	}
+
+	for i, in := range bad {
+		if _, err := LoadRates(strings.NewReader(in)); err == nil {
+			t.Errorf("%d: should have failed", i)
+		}
+	}
+
+	if _, err := LoadRates(strings.NewReader(ratesTable)); err != nil {
+		t.Fatalf("failed %s", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := LoadRates(strings.NewReader(ratesTable))
+	if err != nil {
+		t.Fatalf("failed %s", err)
+	}
+
+	cases := []struct {
+		Amount   Amount
+		Currency string
+		Date     time.Time
+		Output   Amount
+		Success  bool
+	}{
+		// before the first rate the oldest one is used
+		{amount("10"), "USD", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), amount("8"), true},
+		{amount("10"), "USD", time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), amount("8"), true},
+		{amount("10"), "USD", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), amount("9"), true},
+		{amount("-10"), "USD", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), amount("-9"), true},
+		// rounds to the nearest minor unit
+		{amount("0.05"), "GBP", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), amount("0.06"), true},
+		{amount("-0.05"), "GBP", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), amount("-0.06"), true},
+		{amount("10"), "JPY", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 0, false},
+	}
+
+	for i, c := range cases {
+		a, err := rates.Convert(c.Amount, c.Currency, c.Date)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+
+		if !c.Success {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+
+		if a != c.Output {
+			t.Errorf("%d: got %s and should be %s", i, a, c.Output)
+		}
+	}
+
+	// no table at all
+	var none *Rates
+	if _, err := none.Convert(amount("1"), "USD", time.Now()); err == nil {
+		t.Errorf("converting without rates should fail")
+	}
+}
+
+func TestBuildStatsCurrencies(t *testing.T) {
+	rates, err := LoadRates(strings.NewReader(ratesTable))
+	if err != nil {
+		t.Fatalf("failed %s", err)
+	}
+
+	date := time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC)
+	trs := []Transaction{
+		{0, "rent", "", date, amount("-500"), Attrs{}},
+		{1, "book", "", date, amount("-20"), Attrs{Currency: "USD"}},
+		{2, "gift", "", date, amount("100"), Attrs{Currency: "EUR"}},
+		{3, "hotel", "", date, amount("-30"), Attrs{Currency: "JPY"}},
+	}
+
+	s := BuildStats(trs, nil, nil, nil, nil, Settings{Base: "EUR", Rates: rates})
+
+	if s.Treasury.Total != amount("-418") {
+		t.Errorf("total is %s and should be -418", s.Treasury.Total)
+	}
+
+	expected := map[string]Amount{
+		"EUR": amount("-400"),
+		"USD": amount("-20"),
+		"JPY": amount("-30"),
+	}
+	if len(s.Treasury.Currencies) != len(expected) {
+		t.Errorf("got %d currencies and should be %d", len(s.Treasury.Currencies), len(expected))
+	}
+	for cur, a := range expected {
+		if s.Treasury.Currencies[cur] != a {
+			t.Errorf("%s total is %s and should be %s", cur, s.Treasury.Currencies[cur], a)
+		}
+	}
+
+	if len(s.Unconverted) != 1 || s.Unconverted[0] != "JPY" {
+		t.Errorf("unconverted is %v and should be [JPY]", s.Unconverted)
+	}
+
+	// entries keep their own currency and amount
+	if s.Treasury.Entries[1].Currency != "USD" || s.Treasury.Entries[1].Amount != amount("-20") {
+		t.Errorf("entry is %+v", s.Treasury.Entries[1])
+	}
+}
@@ -0,0 +1,222 @@
+package stats
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduler keeps the next occurrence of every event in a min-heap and
+// delivers them through C in date order once their date is reached. A
+// single goroutine waits for all of them.
+type Scheduler struct {
+	C <-chan Timer
+
+	clock Clock
+	c     chan Timer
+	mu    sync.Mutex
+	queue timerQueue
+	index map[uint]*queued // pending timer of each event
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+type queued struct {
+	Timer
+	i int // position in the heap
+}
+
+func NewScheduler(clock Clock) *Scheduler {
+	c := make(chan Timer)
+
+	s := &Scheduler{
+		C:     c,
+		clock: clock,
+		c:     c,
+		index: make(map[uint]*queued),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Add schedules the event to fire at date, replacing the pending timer it
+// may have
+func (s *Scheduler) Add(id uint, date time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.index[id]; ok {
+		q.Date = date
+		heap.Fix(&s.queue, q.i)
+	} else {
+		q := &queued{Timer: Timer{id, date}}
+		heap.Push(&s.queue, q)
+		s.index[id] = q
+	}
+
+	s.signal()
+}
+
+// Reschedule moves the pending timer of the event to date, it returns
+// false if the event had nothing pending
+func (s *Scheduler) Reschedule(id uint, date time.Time) bool {
+	s.mu.Lock()
+	_, ok := s.index[id]
+	s.mu.Unlock()
+
+	if ok {
+		s.Add(id, date)
+	}
+
+	return ok
+}
+
+// Remove forgets about the pending timer of the event, it returns false
+// if there was none
+func (s *Scheduler) Remove(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.index[id]
+	if !ok {
+		return false
+	}
+
+	heap.Remove(&s.queue, q.i)
+	delete(s.index, id)
+	s.signal()
+
+	return true
+}
+
+// Pending returns the timers waiting to fire in date order
+func (s *Scheduler) Pending() []Timer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]Timer, 0, len(s.queue))
+	for _, q := range s.queue {
+		pending = append(pending, q.Timer)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return before(pending[i], pending[j])
+	})
+
+	return pending
+}
+
+// Due takes out every timer whose date is not after now, in date order,
+// without going through C
+func (s *Scheduler) Due(now time.Time) (due []Timer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 && !s.queue[0].Date.After(now) {
+		due = append(due, s.pop().Timer)
+	}
+
+	return
+}
+
+// Stop ends the goroutine of the scheduler, nothing is sent on C after it
+func (s *Scheduler) Stop() {
+	close(s.done)
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// s.mu must be held
+func (s *Scheduler) pop() *queued {
+	q := heap.Pop(&s.queue).(*queued)
+	delete(s.index, q.Id)
+
+	return q
+}
+
+func (s *Scheduler) run() {
+	for {
+		var wait <-chan time.Time
+		var stop func() bool
+
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			if d := s.queue[0].Date.Sub(s.clock.Now()); d > 0 {
+				wait, stop = s.clock.NewTimer(d)
+			} else {
+				q := s.pop()
+				s.mu.Unlock()
+
+				select {
+				case s.c <- q.Timer:
+				case <-s.done:
+					return
+				}
+				continue
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-s.wake:
+		case <-s.done:
+			if stop != nil {
+				stop()
+			}
+			return
+		}
+
+		if stop != nil {
+			stop()
+		}
+	}
+}
+
+// ties are broken by id so the order doesn't depend on the heap
+func before(a, b Timer) bool {
+	if a.Date.Equal(b.Date) {
+		return a.Id < b.Id
+	}
+
+	return a.Date.Before(b.Date)
+}
+
+/* container/heap implementation */
+type timerQueue []*queued
+
+func (q timerQueue) Len() int { return len(q) }
+
+func (q timerQueue) Less(i, j int) bool { return before(q[i].Timer, q[j].Timer) }
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].i = i
+	q[j].i = j
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	item := x.(*queued)
+	item.i = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+
+	return item
+}
@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerOrder(t *testing.T) {
+	s := NewScheduler(RealClock)
+	defer s.Stop()
+
+	now := time.Now()
+
+	// added out of order, all of them already due
+	s.Add(2, now.Add(-1*time.Second))
+	s.Add(0, now.Add(-3*time.Second))
+	s.Add(1, now.Add(-2*time.Second))
+	s.Add(3, now.Add(50*time.Millisecond))
+
+	for _, id := range []uint{0, 1, 2, 3} {
+		select {
+		case timer := <-s.C:
+			if timer.Id != id {
+				t.Fatalf("got %d and should be %d", timer.Id, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout!")
+		}
+	}
+
+	if pending := s.Pending(); len(pending) != 0 {
+		t.Errorf("%d timers still pending", len(pending))
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	s := NewScheduler(RealClock)
+	defer s.Stop()
+
+	now := time.Now()
+
+	s.Add(0, now.Add(100*time.Millisecond))
+	s.Add(1, now.Add(150*time.Millisecond))
+
+	if !s.Remove(0) {
+		t.Errorf("remove should have found the timer")
+	}
+	if s.Remove(0) {
+		t.Errorf("timer removed twice")
+	}
+
+	select {
+	case timer := <-s.C:
+		if timer.Id != 1 {
+			t.Fatalf("got %d and should be 1", timer.Id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout!")
+	}
+
+	select {
+	case timer := <-s.C:
+		t.Fatalf("removed timer %d triggered", timer.Id)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	s := NewScheduler(RealClock)
+	defer s.Stop()
+
+	date := time.Now().Add(time.Hour)
+
+	s.Add(0, date)
+	s.Add(1, date.Add(time.Hour))
+	s.Add(2, date.Add(2*time.Hour))
+
+	// move the first one to the end
+	if !s.Reschedule(0, date.Add(3*time.Hour)) {
+		t.Fatalf("reschedule should have found the timer")
+	}
+	if s.Reschedule(5, date) {
+		t.Errorf("rescheduled a timer that doesn't exist")
+	}
+
+	// adding again replaces the pending timer
+	s.Add(2, date)
+
+	pending := s.Pending()
+	expected := []Timer{
+		{2, date},
+		{1, date.Add(time.Hour)},
+		{0, date.Add(3 * time.Hour)},
+	}
+
+	if len(pending) != len(expected) {
+		t.Fatalf("got %d pending timers and should be %d", len(pending), len(expected))
+	}
+	for i, e := range expected {
+		if pending[i].Id != e.Id || !pending[i].Date.Equal(e.Date) {
+			t.Errorf("%d: got %+v and should be %+v", i, pending[i], e)
+		}
+	}
+}
+
+func TestSchedulerDue(t *testing.T) {
+	s := NewScheduler(RealClock)
+	defer s.Stop()
+
+	date := time.Now().Add(time.Hour)
+
+	s.Add(0, date.Add(2*time.Hour))
+	s.Add(1, date)
+	s.Add(2, date.Add(time.Hour))
+
+	due := s.Due(date.Add(time.Hour))
+	if len(due) != 2 || due[0].Id != 1 || due[1].Id != 2 {
+		t.Fatalf("got %+v", due)
+	}
+
+	if pending := s.Pending(); len(pending) != 1 || pending[0].Id != 0 {
+		t.Errorf("pending is %+v", pending)
+	}
+}
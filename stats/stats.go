@@ -6,31 +6,38 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var TRINDEX uint
-var EVINDEX uint
-
 /* -- output -- */
 type Stats struct {
-	Treasury Activity
-	Income   Activity
-	Expenses Activity
-	Balance  float64
+	Treasury    Activity
+	Income      Activity
+	Expenses    Activity
+	Balance     Amount
+	Unconverted []string          `json:",omitempty"` // currencies without exchange rate
+	Accounts    []AccountActivity `json:",omitempty"`
+	Budgets     []BudgetStatus    `json:",omitempty"` // for the current month
+	Events      []Event           `json:",omitempty"`
+	Period      *Period           `json:",omitempty"` // nil for the current month
+	History     []Summary         `json:",omitempty"` // last months, oldest first
 }
 
 type Activity struct {
-	Total   float64
-	Entries []Entry
+	Total      Amount // in the base currency
+	Entries    []Entry
+	Currencies map[string]Amount `json:",omitempty"` // totals in each currency
+	Categories map[string]Amount `json:",omitempty"` // totals of categorized entries in the base currency
 }
 
 type Entry struct {
 	Name   string
-	Amount float64
+	Amount Amount // in the currency of the entry
 	Date   time.Time
+	Attrs
 }
 
 /* -------------- */
@@ -41,7 +48,8 @@ type Transaction struct {
 	Name        string
 	Description string
 	Date        time.Time
-	Amount      float64
+	Amount      Amount
+	Attrs
 }
 
 type Event struct {
@@ -51,12 +59,74 @@ type Event struct {
 	Date        time.Time // date the amount will be added/subtracted
 	Times       int       // times this event will repeat (-1 is indefinite)
 	Step        [3]int    // time step for next repetition (if times is 0 this is ignored)
-	Amount      float64
+	Amount      Amount
+	Attrs
+	State       EventState
+}
+
+type EventState int
+
+const (
+	Active    EventState = iota
+	Paused               // doesn't fire until resumed
+	Cancelled            // never fires again
+)
+
+var eventStates = []string{"active", "paused", "cancelled"}
+
+func (s EventState) String() string {
+	if s < 0 || int(s) >= len(eventStates) {
+		return "EventState(" + strconv.Itoa(int(s)) + ")"
+	}
+
+	return eventStates[s]
+}
+
+func (s EventState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *EventState) UnmarshalText(b []byte) error {
+	for i, name := range eventStates {
+		if string(b) == name {
+			*s = EventState(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown event state %q", b)
+}
+
+// optional attributes shared by transactions, events and their entries
+type Attrs struct {
+	Currency string `json:",omitempty"` // empty is the base currency
+	Account  string   `json:",omitempty"` // empty if it isn't tied to an account
+	Category string   `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+	Ref      string   `json:",omitempty"` // id given by the bank, if imported
 }
 
 type Timer struct {
 	Id   uint
-	Date time.Time
+	Date time.Time // date of the occurrence the timer was set for
+}
+
+/* -------------- */
+
+/* -- settings -- */
+type Settings struct {
+	Base    string // currency amounts are converted to
+	Rates   *Rates
+	Clock   Clock // the real one if nil
+	History int   // months of history in the stats
+}
+
+func (s Settings) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+
+	return s.Clock.Now()
 }
 
 /* -------------- */
@@ -70,8 +140,8 @@ func Parse(in io.Reader) ([]string, error) {
 
 func ProcessTransaction(in []string) (Transaction, error) {
     /*
-    * tr    <name>  <description>   <date>      <amount>
-    * tr    foo     bar             yyyy-mm-dd  200 
+    * tr    <name>  <description>   <date>      <amount>    [cur=<currency>] [acc=<account>] [cat=<category>] [tags=<tag>,...]
+    * tr    foo     bar             yyyy-mm-dd  200         cur=USD          acc=cash        cat=food         tags=bar,friday
     */
 	if len(in) < 5 {
 		return Transaction{}, fmt.Errorf("process transaction: missing arguments")
@@ -90,32 +160,43 @@ func ProcessTransaction(in []string) (Transaction, error) {
 	}
 
 	// parse amount
-	amount, err := strconv.ParseFloat(in[4], 64)
+	amount, err := ParseAmount(in[4])
 	if err != nil {
 		return Transaction{}, fmt.Errorf("process transaction: %s", err)
 	}
 
-    return BuildTransaction(name, description, date, amount), nil
-}
+	// optional attributes
+	attrs, err := parseAttrs(in[5:])
+	if err != nil {
+		return Transaction{}, fmt.Errorf("process transaction: %s", err)
+	}
 
-func BuildTransaction(name, description string, date time.Time, amount float64) Transaction {
-	// calculate index
-	index := TRINDEX
-	TRINDEX++
+    return BuildTransaction(name, description, date, amount, attrs), nil
+}
 
+func BuildTransaction(name, description string, date time.Time, amount Amount, attrs Attrs) Transaction {
+	// the id is given by the ledger the transaction is added to
     return Transaction {
-        index,
+        0,
         name,
         description,
         date,
         amount,
+        attrs,
     }
 }
 
+// TransactionRecord returns the tr command that gives the transaction
+func TransactionRecord(tr Transaction) []string {
+	record := []string{"tr", tr.Name, tr.Description, tr.Date.Format("2006-01-02"), tr.Amount.String()}
+
+	return append(record, attrsRecord(tr.Attrs)...)
+}
+
 func ProcessEvent(in []string) (Event, error) {
     /*
-    * ev    <name>  <description>   <date>      <times> <year>,<month>,<day>    <amount>
-    * ev    foo     bar             yyyy-mm-dd  1       1,2,3                   200
+    * ev    <name>  <description>   <date>      <times> <year>,<month>,<day>    <amount>    [cur=<currency>] [acc=<account>] [cat=<category>] [tags=<tag>,...]
+    * ev    foo     bar             yyyy-mm-dd  1       1,2,3                   200         cur=USD          acc=cash        cat=food         tags=bar,friday
     */
 	if len(in) < 7 {
 		return Event{}, fmt.Errorf("process event: missing arguments")
@@ -143,88 +224,364 @@ func ProcessEvent(in []string) (Event, error) {
         return Event{}, fmt.Errorf("times can't be 0")
     }
 
-    // if times is greater than 1 (that means is going to generate a timer) parse step
-    // else ignore steps
+    // an event that repeats (more than once or forever, when times is
+    // negative) needs a step, else ignore steps
 	var step [3]int
 
-    if times > 1 {
-        // parse step
-        for i, stepStr := range strings.Split(in[5], ",") {
-            s, err := strconv.ParseInt(stepStr, 10, 32)
-            if err != nil {
-                return Event{}, fmt.Errorf("process event: %s", err)
-            }
-
-            step[i] = int(s)
-        }
-
-        if step[0] < 0 || step[1] < 0 || step[2] < 0 {
-            return Event{}, fmt.Errorf("no value in steps should be negative")
-        }
-        if step[0] == 0 && step[1] == 0 && step[2] == 0 {
-            return Event{}, fmt.Errorf("one of the values on steps should be greater than 0")
+    if times != 1 {
+        if step, err = parseStep(in[5]); err != nil {
+            return Event{}, fmt.Errorf("process event: %s", err)
         }
     }
 
 	// parse amount
-	amount, err := strconv.ParseFloat(in[6], 64)
+	amount, err := ParseAmount(in[6])
 	if err != nil {
 		return Event{}, fmt.Errorf("process event: %s", err)
 	}
 
-    return BuildEvent(name, description, date, int(times), step, amount), nil
-}
+	// optional attributes
+	attrs, err := parseAttrs(in[7:])
+	if err != nil {
+		return Event{}, fmt.Errorf("process event: %s", err)
+	}
 
-func BuildEvent(name, description string, date time.Time, times int, step [3]int, amount float64) Event {
-	// calculate index
-	index := EVINDEX
-	EVINDEX++
+    return BuildEvent(name, description, date, int(times), step, amount, attrs), nil
+}
 
+func BuildEvent(name, description string, date time.Time, times int, step [3]int, amount Amount, attrs Attrs) Event {
+	// the id is given by the ledger the event is added to
     return Event {
-		index,
+		0,
 		name,
 		description,
 		date,
 		int(times),
 		step,
 		amount,
+		attrs,
+		Active,
     }
 }
 
-func BuildStats(Transactions []Transaction, Events []Event) (stats Stats) {
+// EventRecord returns the ev command that gives the event
+func EventRecord(ev Event) []string {
+	step := fmt.Sprintf("%d,%d,%d", ev.Step[0], ev.Step[1], ev.Step[2])
+	record := []string{"ev", ev.Name, ev.Description, ev.Date.Format("2006-01-02"), strconv.Itoa(ev.Times), step, ev.Amount.String()}
+
+	return append(record, attrsRecord(ev.Attrs)...)
+}
+
+/*
+* <year>,<month>,<day>
+* 0,1,0
+*/
+func parseStep(in string) (step [3]int, err error) {
+	parts := strings.Split(in, ",")
+	if len(parts) > 3 {
+		return step, fmt.Errorf("step %q has more than 3 values", in)
+	}
+
+	for i, stepStr := range parts {
+		s, err := strconv.ParseInt(stepStr, 10, 32)
+		if err != nil {
+			return step, err
+		}
+
+		step[i] = int(s)
+	}
+
+	if step[0] < 0 || step[1] < 0 || step[2] < 0 {
+		return step, fmt.Errorf("no value in steps should be negative")
+	}
+	if step[0] == 0 && step[1] == 0 && step[2] == 0 {
+		return step, fmt.Errorf("one of the values on steps should be greater than 0")
+	}
+
+	return
+}
+
+// parseAttrs reads the optional <key>=<value> arguments that follow the
+// positional ones of a command
+func parseAttrs(in []string) (attrs Attrs, err error) {
+	for _, arg := range in {
+		key, value, err := splitArg(arg)
+		if err != nil {
+			return Attrs{}, err
+		}
+
+		if err = setAttr(&attrs, key, value); err != nil {
+			return Attrs{}, err
+		}
+	}
+
+	return
+}
+
+// attrsRecord returns the <key>=<value> arguments of the attributes set
+func attrsRecord(attrs Attrs) (record []string) {
+	if attrs.Currency != "" {
+		record = append(record, "cur="+attrs.Currency)
+	}
+	if attrs.Account != "" {
+		record = append(record, "acc="+attrs.Account)
+	}
+	if attrs.Category != "" {
+		record = append(record, "cat="+attrs.Category)
+	}
+	if len(attrs.Tags) > 0 {
+		record = append(record, "tags="+strings.Join(attrs.Tags, ","))
+	}
+	if attrs.Ref != "" {
+		record = append(record, "ref="+attrs.Ref)
+	}
+
+	return
+}
+
+func splitArg(arg string) (key, value string, err error) {
+	kv := strings.SplitN(arg, "=", 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("%q is not a <key>=<value> argument", arg)
+	}
+
+	return kv[0], kv[1], nil
+}
+
+func setAttr(attrs *Attrs, key, value string) (err error) {
+	switch key {
+	case "cur":
+		currency, err := parseCurrency(value)
+		if err != nil {
+			return err
+		}
+		attrs.Currency = currency
+	case "acc":
+		if value == "" {
+			return fmt.Errorf("empty account")
+		}
+		attrs.Account = value
+	case "cat":
+		if value == "" {
+			return fmt.Errorf("empty category")
+		}
+		attrs.Category = value
+	case "tags":
+		var tags []string
+		for _, tag := range strings.Split(value, ",") {
+			if tag == "" {
+				return fmt.Errorf("empty tag")
+			}
+			tags = append(tags, tag)
+		}
+		attrs.Tags = tags
+	case "ref":
+		if value == "" {
+			return fmt.Errorf("empty reference")
+		}
+		attrs.Ref = value
+	default:
+		return fmt.Errorf("unknown argument %q", key)
+	}
+
+	return
+}
+
+// currencies are ISO 4217 codes like USD or EUR
+func parseCurrency(s string) (string, error) {
+	code := strings.ToUpper(s)
+
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency %q", s)
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("invalid currency %q", s)
+		}
+	}
+
+	return code, nil
+}
+
+// BuildStats builds the status: every transaction is in the treasury,
+// income and expenses are those of the current month the way
+// BuildPeriodStats has them, Fired are the ids of the transactions the
+// events generated
+func BuildStats(Transactions []Transaction, Fired map[uint]bool, Events []Event, Accounts []Account, Budgets []Budget, settings Settings) Stats {
+	now := settings.now()
+	p := MonthPeriod(now)
+
+	return buildStats(Transactions, firedIn(Transactions, Fired, p), Events, Accounts, Budgets, settings, now, upcoming(p, now))
+}
+
+// BuildPeriodStats builds the stats of the transactions in the period and of
+// every occurrence of the events that falls in it: the ones that already
+// happened are the transactions in Fired, the ids of those the events
+// generated, and the ones still to come are projected from the events.
+// Budgets are only there when the period is a month.
+func BuildPeriodStats(Transactions []Transaction, Fired map[uint]bool, Events []Event, Accounts []Account, Budgets []Budget, settings Settings, p Period) Stats {
+	var transactions []Transaction
 	for _, tr := range Transactions {
-		stats.Treasury.Total += tr.Amount
-		stats.Treasury.Entries = append(stats.Treasury.Entries, Entry{
+		if p.Contains(tr.Date) {
+			transactions = append(transactions, tr)
+		}
+	}
+
+	if p != MonthPeriod(p.From) {
+		Budgets = nil
+	}
+
+	stats := buildStats(transactions, firedIn(transactions, Fired, p), Events, Accounts, Budgets, settings, p.From, upcoming(p, settings.now()))
+	stats.Period = &p
+
+	return stats
+}
+
+// firedIn returns the transactions in the period the events generated
+func firedIn(Transactions []Transaction, Fired map[uint]bool, p Period) (fired []Transaction) {
+	for _, tr := range Transactions {
+		if Fired[tr.Id] && p.Contains(tr.Date) {
+			fired = append(fired, tr)
+		}
+	}
+
+	return
+}
+
+// upcoming returns the occurrences of an event in the period from now on,
+// those before now are transactions already
+func upcoming(p Period, now time.Time) func(Event) []time.Time {
+	return func(ev Event) (dates []time.Time) {
+		for _, date := range occurrences(ev, p) {
+			if !date.Before(now) {
+				dates = append(dates, date)
+			}
+		}
+		return
+	}
+}
+
+// buildStats puts the transactions in the treasury, and the occurrences of
+// the events in income and expenses along with the transactions in fired
+// the events already generated. Budgets are for the month of month.
+func buildStats(Transactions, fired []Transaction, Events []Event, Accounts []Account, Budgets []Budget, settings Settings, month time.Time, occurrences func(Event) []time.Time) (stats Stats) {
+	unconverted := make(map[string]bool)
+
+	for _, ac := range Accounts {
+		stats.Accounts = append(stats.Accounts, AccountActivity{
+			Name: ac.Name,
+			Kind: ac.Kind,
+		})
+	}
+
+	// take an amount to the base currency
+	convert := func(amount Amount, attrs Attrs, date time.Time) (Amount, bool) {
+		if attrs.Currency == "" || attrs.Currency == settings.Base {
+			return amount, true
+		}
+
+		converted, err := settings.Rates.Convert(amount, attrs.Currency, date)
+		if err != nil {
+			unconverted[attrs.Currency] = true
+			return 0, false
+		}
+
+		return converted, true
+	}
+
+	// add an amount to an activity, both in its currency and in the base one
+	add := func(a *Activity, amount Amount, attrs Attrs, date time.Time) Amount {
+		currency := attrs.Currency
+		if currency == "" {
+			currency = settings.Base
+		}
+
+		if currency != "" {
+			if a.Currencies == nil {
+				a.Currencies = make(map[string]Amount)
+			}
+			a.Currencies[currency] += amount
+		}
+
+		amount, ok := convert(amount, attrs, date)
+		if !ok {
+			return 0
+		}
+
+		a.Total += amount
+
+		if attrs.Category != "" {
+			if a.Categories == nil {
+				a.Categories = make(map[string]Amount)
+			}
+			a.Categories[attrs.Category] += amount
+		}
+
+		return amount
+	}
+
+	for _, tr := range Transactions {
+		entry := Entry{
 			tr.Name,
 			tr.Amount,
 			tr.Date,
-		})
+			tr.Attrs,
+		}
+
+		add(&stats.Treasury, tr.Amount, tr.Attrs, tr.Date)
+		stats.Treasury.Entries = append(stats.Treasury.Entries, entry)
+
+		// transactions on undeclared accounts only show up in the treasury
+		if i := FindAccount(tr.Account, Accounts); i >= 0 {
+			ac := &stats.Accounts[i].Activity
+			add(ac, tr.Amount, tr.Attrs, tr.Date)
+			ac.Entries = append(ac.Entries, entry)
+		}
 	}
 
-	for _, ev := range Events {
-		if !inMonth(ev.Date, time.Now()) {
-			continue
+	// an occurrence brings or takes money
+	occurred := func(entry Entry) {
+		if entry.Amount >= 0 {
+			stats.Balance += add(&stats.Income, entry.Amount, entry.Attrs, entry.Date)
+			stats.Income.Entries = append(stats.Income.Entries, entry)
+		} else {
+			stats.Balance += add(&stats.Expenses, entry.Amount, entry.Attrs, entry.Date)
+			stats.Expenses.Entries = append(stats.Expenses.Entries, entry)
 		}
+	}
 
-		stats.Balance += ev.Amount
+	for _, tr := range fired {
+		occurred(Entry{
+			tr.Name,
+			tr.Amount,
+			tr.Date,
+			tr.Attrs,
+		})
+	}
 
-		if ev.Amount >= 0 {
-			stats.Income.Total += ev.Amount
-			stats.Income.Entries = append(stats.Income.Entries, Entry{
-				ev.Name,
-				ev.Amount,
-				ev.Date,
-			})
-		} else {
-			stats.Expenses.Total += ev.Amount
-			stats.Expenses.Entries = append(stats.Expenses.Entries, Entry{
+	for _, ev := range Events {
+		stats.Events = append(stats.Events, ev)
+
+		// paused and cancelled events won't bring or take any money
+		for _, date := range occurrences(ev) {
+			occurred(Entry{
 				ev.Name,
 				ev.Amount,
-				ev.Date,
+				date,
+				ev.Attrs,
 			})
 		}
 	}
 
+	stats.Budgets = buildBudgets(Budgets, Transactions, month, func(tr Transaction) (Amount, bool) {
+		return convert(tr.Amount, tr.Attrs, tr.Date)
+	})
+
+	for currency := range unconverted {
+		stats.Unconverted = append(stats.Unconverted, currency)
+	}
+	sort.Strings(stats.Unconverted)
+
 	return
 }
 
@@ -233,7 +590,12 @@ func inMonth(d, month time.Time) bool {
 }
 
 func UpdateStats(s Stats, f *os.File) error {
-	serialized, err := json.Marshal(s)
+	return writeJSON(s, f)
+}
+
+// writeJSON replaces the content of the file with v
+func writeJSON(v interface{}, f *os.File) error {
+	serialized, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
@@ -247,14 +609,49 @@ func UpdateStats(s Stats, f *os.File) error {
 	return nil
 }
 
-func StartTimer(ev Event, now time.Time, timer chan<- Timer) {
-	duration := ev.Date.Sub(now)
+// Advance consumes the current occurrence of the event: it decrements
+// Times, unless the event repeats forever, and if the event keeps repeating
+// moves Date to the next one
+func Advance(ev *Event) {
+	if ev.Times > 0 {
+		ev.Times--
+	}
 
-	go func() {
-		t := <-time.After(duration)
-		timer <- Timer{
-			ev.Id,
-			t,
-		}
-	}()
+	if ev.Times == 0 {
+		return
+	}
+
+	ev.Date = ev.Date.AddDate(ev.Step[0], ev.Step[1], ev.Step[2])
+}
+
+// Skip moves the event past now without consuming any occurrence, the
+// ones of an event that can't repeat are dropped
+func Skip(ev *Event, now time.Time) {
+	if ev.Times == 0 || ev.Date.After(now) {
+		return
+	}
+
+	if ev.Step[0] == 0 && ev.Step[1] == 0 && ev.Step[2] == 0 {
+		ev.Times = 0
+		return
+	}
+
+	for !ev.Date.After(now) {
+		ev.Date = ev.Date.AddDate(ev.Step[0], ev.Step[1], ev.Step[2])
+	}
+}
+
+// Missed returns the dates of every occurrence of the event that should
+// have fired at or before now, in order
+func Missed(ev Event, now time.Time) (dates []time.Time) {
+	if ev.State != Active {
+		return
+	}
+
+	for ev.Times != 0 && !ev.Date.After(now) {
+		dates = append(dates, ev.Date)
+		Advance(&ev)
+	}
+
+	return
 }
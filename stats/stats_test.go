@@ -1,10 +1,12 @@
 package stats
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -49,7 +51,7 @@ type TrCase struct {
     Name string
     Description string
     Date time.Time
-    Amount float64
+    Amount Amount
 }
 
 type BuildEventCase struct {
@@ -63,7 +65,7 @@ type EvCase struct {
     Date time.Time
     Times int
     Step [3]int
-    Amount float64
+    Amount Amount
 }
 
 func TestParse(t *testing.T) {
@@ -131,18 +133,20 @@ func TestProcessTransaction(t *testing.T) {
 				"foo",
 				"bar",
 				time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
-				100,
+				amount("100"),
+				Attrs{},
 			},
 			true,
 		},
 		{
 			[]string{"Tr", "", "", "2021-02-03", "30.10"},
 			Transaction{
-				1,
+				0,
 				"",
 				"",
 				time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC),
-				30.10,
+				amount("30.10"),
+				Attrs{},
 			},
 			true,
 		},
@@ -211,7 +215,7 @@ func TestProcessTransaction(t *testing.T) {
 		if tr.Amount != c.Output.Amount {
 			failed = true
 			if c.Success {
-				t.Errorf("%d: Amount -> %f and should be %f", i, tr.Amount, c.Output.Amount)
+				t.Errorf("%d: Amount -> %s and should be %s", i, tr.Amount, c.Output.Amount)
 			}
 		}
 
@@ -224,28 +228,32 @@ func TestProcessTransaction(t *testing.T) {
 func TestProcessEvent(t *testing.T) {
 	tpe := []ProcessEventCase{
 		{
-			[]string{"Ev", "foo", "bar", "2020-10-10", "-1", "0,0,0", "2020"},
+			[]string{"Ev", "foo", "bar", "2020-10-10", "-1", "0,1,0", "2020"},
 			Event{
 				0,
 				"foo",
 				"bar",
 				time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC),
 				-1,
-				[3]int{0, 0, 0},
-				2020,
+				[3]int{0, 1, 0},
+				amount("2020"),
+				Attrs{},
+				Active,
 			},
 			true,
 		},
 		{
 			[]string{"Ev", "", "", "2100-01-02", "10", "1,2,3", "2"},
 			Event{
-				1,
+				0,
 				"",
 				"",
 				time.Date(2100, 1, 2, 0, 0, 0, 0, time.UTC),
 				10,
 				[3]int{1, 2, 3},
-				2,
+				amount("2"),
+				Attrs{},
+				Active,
 			},
 			true,
 		},
@@ -259,6 +267,11 @@ func TestProcessEvent(t *testing.T) {
 			Event{},
 			false,
 		},
+		{
+			[]string{"Ev", "foo", "", "2020-10-10", "-1", "0,0,0", "1"},
+			Event{},
+			false,
+		},
 	}
 
 	for i, c := range tpe {
@@ -318,7 +331,7 @@ func TestProcessEvent(t *testing.T) {
 		if ev.Amount != c.Output.Amount {
 			failed = true
 			if c.Success {
-				t.Errorf("%d: Amount -> %f should be %f", i, ev.Amount, c.Output.Amount)
+				t.Errorf("%d: Amount -> %s should be %s", i, ev.Amount, c.Output.Amount)
 			}
 		}
 
@@ -340,24 +353,34 @@ func TestBuildStats(t *testing.T) {
 					"foo",
 					"bar",
 					now,
-					200.10,
+					amount("200.10"),
+					Attrs{},
 				},
 			},
 			[]Event{},
 			Stats{
 				Activity{
-					200.10,
+					amount("200.10"),
 					[]Entry{
 						{
 							"foo",
-							200.10,
+							amount("200.10"),
 							now,
+							Attrs{},
 						},
 					},
+					nil,
+					nil,
 				},
 				Activity{},
 				Activity{},
 				0,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
 			},
 			true,
 		},
@@ -370,14 +393,16 @@ func TestBuildStats(t *testing.T) {
 					"foo",
 					"bar",
 					time.Date(2020, 01, 01, 0, 0, 0, 0, time.UTC),
-					10,
+					amount("10"),
+					Attrs{},
 				},
 				{
 					1,
 					"bar",
 					"",
 					time.Date(2020, 01, 02, 0, 0, 0, 0, time.UTC),
-					5.5,
+					amount("5.5"),
+					Attrs{},
 				},
 			},
 			[]Event{
@@ -388,7 +413,9 @@ func TestBuildStats(t *testing.T) {
 					now,
 					1,
 					[3]int{0, 0, 1},
-					100.101,
+					amount("100.10"),
+					Attrs{},
+					Active,
 				},
 				{
 					1,
@@ -397,7 +424,9 @@ func TestBuildStats(t *testing.T) {
 					now,
 					1,
 					[3]int{0, 0, 2},
-					10.5,
+					amount("10.5"),
+					Attrs{},
+					Active,
 				},
 				{
 					2,
@@ -405,52 +434,71 @@ func TestBuildStats(t *testing.T) {
 					"",
 					now,
 					2,
-					[3]int{0, 0, 3},
-					-22.1,
+					[3]int{0, 1, 0},
+					amount("-22.1"),
+					Attrs{},
+					Active,
 				},
 			},
 			Stats{
 				Activity{
-					15.5,
+					amount("15.5"),
 					[]Entry{
 						{
 							"foo",
-							10,
+							amount("10"),
 							time.Date(2020, 01, 01, 0, 0, 0, 0, time.UTC),
+							Attrs{},
 						},
 						{
 							"bar",
-							5.5,
+							amount("5.5"),
 							time.Date(2020, 01, 02, 0, 0, 0, 0, time.UTC),
+							Attrs{},
 						},
 					},
+					nil,
+					nil,
 				},
 				Activity{
-					110.601,
+					amount("110.60"),
 					[]Entry{
 						{
 							"event",
-							100.101,
+							amount("100.10"),
 							now,
+							Attrs{},
 						},
 						{
 							"event1",
-							10.5,
+							amount("10.5"),
 							now,
+							Attrs{},
 						},
 					},
+					nil,
+					nil,
 				},
 				Activity{
-					-22.1,
+					amount("-22.1"),
 					[]Entry{
 						{
 							"event2",
-							-22.1,
+							amount("-22.1"),
 							now,
+							Attrs{},
 						},
 					},
+					nil,
+					nil,
 				},
-				88.501,
+				amount("88.50"),
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
 			},
 			true,
 		},
@@ -458,7 +506,7 @@ func TestBuildStats(t *testing.T) {
 
 	for i, c := range bsc {
 		failed := false
-		s := BuildStats(c.TrInput, c.EvInput)
+		s := BuildStats(c.TrInput, nil, c.EvInput, nil, nil, Settings{Clock: NewVirtualClock(now)})
 
 		if !checkActivity(s.Treasury, c.Output.Treasury, c.Success, "treasury", i, t) {
 			failed = true
@@ -473,7 +521,7 @@ func TestBuildStats(t *testing.T) {
 		if s.Balance != c.Output.Balance {
 			failed = true
 			if c.Success {
-				t.Errorf("%d: balance is %f but should be %f", i, s.Balance, c.Output.Balance)
+				t.Errorf("%d: balance is %s but should be %s", i, s.Balance, c.Output.Balance)
 			}
 		}
 
@@ -489,7 +537,7 @@ func checkActivity(a0, a1 Activity, success bool, name string, i int, t *testing
 	if a0.Total != a1.Total {
 		failed = false
 		if success {
-			t.Errorf("%d: %s -> total is %f but should be %f", i, name, a0.Total, a1.Total)
+			t.Errorf("%d: %s -> total is %s but should be %s", i, name, a0.Total, a1.Total)
 		}
 	}
 
@@ -506,7 +554,7 @@ func checkActivity(a0, a1 Activity, success bool, name string, i int, t *testing
 		if e0.Amount != e1.Amount {
 			failed = false
 			if success {
-				t.Errorf("%d - %d: %s -> amount is %f but should be %f", i, j, name, e0.Amount, e1.Amount)
+				t.Errorf("%d - %d: %s -> amount is %s but should be %s", i, j, name, e0.Amount, e1.Amount)
 			}
 		}
 
@@ -526,18 +574,27 @@ func TestUpdateStats(t *testing.T) {
 		{
 			Stats{
 				Activity{
-					100.4,
+					amount("100.4"),
 					[]Entry{
 						{
 							"foo",
-							100.4,
+							amount("100.4"),
 							time.Date(2020, 01, 01, 0, 0, 0, 0, time.UTC),
+							Attrs{},
 						},
 					},
+					nil,
+					nil,
 				},
 				Activity{},
 				Activity{},
 				0,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
 			},
 			"{\"Treasury\":{\"Total\":100.4,\"Entries\":[{\"Name\":\"foo\",\"Amount\":100.4,\"Date\":\"2020-01-01T00:00:00Z\"}]},\"Income\":{\"Total\":0,\"Entries\":null},\"Expenses\":{\"Total\":0,\"Entries\":null},\"Balance\":0}",
 		},
@@ -594,34 +651,8 @@ func TestUpdateStats(t *testing.T) {
 	}
 }
 
-func TestStartTimer(t *testing.T) {
-	ev := Event{
-		0,
-		"foo",
-		"bar",
-		time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC),
-		0,
-		[3]int{0, 0, 0},
-		230.10,
-	}
-	now := time.Date(2020, 1, 1, 0, 0, 2, 0, time.UTC)
-	out := make(chan Timer, 5)
-
-	StartTimer(ev, now, out)
-
-	select {
-	case timer := <-out:
-		if ev.Id != timer.Id {
-			t.Fatalf("%d -> %d", timer.Id, ev.Id)
-		}
-
-	case <-time.After(5 * time.Second):
-		t.Fatal("Timeout!")
-	}
-}
-
 func TestBuildTransactions(t * testing.T) {
-    TRINDEX = 0
+    l := NewLedger(Settings{})
     now := time.Now()
 
     cases := []TrCase{
@@ -629,19 +660,19 @@ func TestBuildTransactions(t * testing.T) {
             "foo",
             "bar",
             now,
-            200,
+            amount("200"),
         },
         {
             "bar",
             "foo",
             now,
-            130.9,
+            amount("130.9"),
         },
         {
             "a",
             "b",
             now,
-            11,
+            amount("11"),
         },
     }
 
@@ -655,18 +686,20 @@ func TestBuildTransactions(t * testing.T) {
             c.Description,
             c.Date,
             c.Amount,
+            Attrs{},
         }
 
         actualTCs = append(actualTCs, BuildTransactionCase{c, tr})
     }
 
     for i, tc := range actualTCs {
-        tr := BuildTransaction(
+        tr := l.AddTransaction(BuildTransaction(
             tc.Input.Name,
             tc.Input.Description,
             tc.Input.Date,
             tc.Input.Amount,
-        )
+            Attrs{},
+        ))
 
         if tr.Id != tc.Output.Id {
             t.Errorf("TC %d: got id %d and should be %d", i, tr.Id, tc.Output.Id)
@@ -681,13 +714,13 @@ func TestBuildTransactions(t * testing.T) {
             t.Errorf("TC %d: got date %s and should be %s", i, tr.Date, tc.Output.Date)
         }
         if tr.Amount != tc.Output.Amount {
-            t.Errorf("TC %d: got amount %f and should be %f", i, tr.Amount, tc.Output.Amount)
+            t.Errorf("TC %d: got amount %s and should be %s", i, tr.Amount, tc.Output.Amount)
         }
     }
 }
 
 func TestBuildEvent(t *testing.T) {
-    EVINDEX = 0
+    l := NewLedger(Settings{})
     now := time.Now()
 
     cases := []EvCase {
@@ -697,7 +730,7 @@ func TestBuildEvent(t *testing.T) {
             now,
             2,
             [3]int{1, 2, 3},
-            200,
+            amount("200"),
         },
         {
             "bar",
@@ -705,7 +738,7 @@ func TestBuildEvent(t *testing.T) {
             now,
             -1,
             [3]int{0, 0, 1},
-            20,
+            amount("20"),
         },
         {
             "a",
@@ -713,7 +746,7 @@ func TestBuildEvent(t *testing.T) {
             now,
             1,
             [3]int{0, 0, 0},
-            2000,
+            amount("2000"),
         },
     }
 
@@ -729,20 +762,23 @@ func TestBuildEvent(t *testing.T) {
             c.Times,
             c.Step,
             c.Amount,
+            Attrs{},
+            Active,
         }
 
         actualTCs = append(actualTCs, BuildEventCase{c, ev})
     }
 
     for i, tc := range actualTCs {
-        ev := BuildEvent(
+        ev := l.AddEvent(BuildEvent(
             tc.Input.Name,
             tc.Input.Description,
             tc.Input.Date,
             tc.Input.Times,
             tc.Input.Step,
             tc.Input.Amount,
-        )
+            Attrs{},
+        ))
 
         if ev.Id != tc.Output.Id {
             t.Errorf("TC %d: got id %d and should be %d", i, ev.Id, tc.Output.Id)
@@ -765,7 +801,323 @@ func TestBuildEvent(t *testing.T) {
             }
         }
         if ev.Amount != tc.Output.Amount {
-            t.Errorf("TC %d: got amount %f and should be %f", i, ev.Amount, tc.Output.Amount)
+            t.Errorf("TC %d: got amount %s and should be %s", i, ev.Amount, tc.Output.Amount)
         }
     }
 }
+
+func TestAdvance(t *testing.T) {
+	ev := Event{
+		0,
+		"foo",
+		"bar",
+		time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		2,
+		[3]int{0, 1, 0},
+		amount("10"),
+		Attrs{},
+		Active,
+	}
+
+	Advance(&ev)
+	if ev.Times != 1 {
+		t.Errorf("times is %d and should be 1", ev.Times)
+	}
+	if !ev.Date.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date is %s and should be 2020-03-02", ev.Date)
+	}
+
+	Advance(&ev)
+	if ev.Times != 0 {
+		t.Errorf("times is %d and should be 0", ev.Times)
+	}
+	if !ev.Date.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date moved to %s after the last occurrence", ev.Date)
+	}
+
+	// an event that repeats forever never runs out nor counts down
+	ev = event("ev", "foo", "", "2020-01-15", "-1", "0,1,0", "10")
+	for i := 0; i < 12; i++ {
+		Advance(&ev)
+	}
+	if ev.Times != -1 || !ev.Date.Equal(time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got times %d and date %s", ev.Times, ev.Date)
+	}
+}
+
+// event processes an ev command for test cases
+func event(in ...string) Event {
+	ev, err := ProcessEvent(in)
+	if err != nil {
+		panic(err)
+	}
+
+	return ev
+}
+
+func TestMissed(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Times  string
+		Step   string
+		Output []time.Time
+	}{
+		// forever, monthly
+		{
+			"-1",
+			"0,1,0",
+			[]time.Time{
+				start,
+				time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		// times limits the occurrences
+		{
+			"2",
+			"0,1,0",
+			[]time.Time{
+				start,
+				time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		// single occurrence
+		{
+			"1",
+			"0,0,0",
+			[]time.Time{start},
+		},
+	}
+
+	for i, c := range cases {
+		ev := event("ev", "foo", "", "2020-01-01", c.Times, c.Step, "1")
+		times := ev.Times
+
+		dates := Missed(ev, now)
+		if len(dates) != len(c.Output) {
+			t.Errorf("%d: got %d dates and should be %d", i, len(dates), len(c.Output))
+			continue
+		}
+		for j, d := range dates {
+			if !d.Equal(c.Output[j]) {
+				t.Errorf("%d - %d: got %s and should be %s", i, j, d, c.Output[j])
+			}
+		}
+
+		// the event passed by value is untouched
+		if ev.Times != times || !ev.Date.Equal(start) {
+			t.Errorf("%d: event was modified", i)
+		}
+	}
+
+	// nothing is missed when the event is done or in the future
+	ev := Event{0, "foo", "", start, 0, [3]int{0, 1, 0}, 1, Attrs{}, Active}
+	if dates := Missed(ev, now); len(dates) != 0 {
+		t.Errorf("done event got %d missed dates", len(dates))
+	}
+
+	ev = event("ev", "foo", "", "2020-04-16", "-1", "0,0,1", "1")
+	if dates := Missed(ev, now); len(dates) != 0 {
+		t.Errorf("future event got %d missed dates", len(dates))
+	}
+}
+
+func TestProcessAttrs(t *testing.T) {
+	cases := []struct {
+		Input   []string
+		Output  Attrs
+		Success bool
+	}{
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "cur=usd"}, Attrs{Currency: "USD"}, true},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "acc=cash", "cur=usd"}, Attrs{Currency: "USD", Account: "cash"}, true},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "acc="}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "cat=food", "tags=bar,friday"}, Attrs{Category: "food", Tags: []string{"bar", "friday"}}, true},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "cat="}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "tags=a,,b"}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10"}, Attrs{}, true},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "ref=9f3a"}, Attrs{Ref: "9f3a"}, true},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "ref="}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "cur=dollars"}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "USD"}, Attrs{}, false},
+		{[]string{"tr", "foo", "bar", "2020-01-01", "10", "foo=bar"}, Attrs{}, false},
+	}
+
+	for i, c := range cases {
+		tr, err := ProcessTransaction(c.Input)
+		if err != nil {
+			if c.Success {
+				t.Errorf("%d: failed %s", i, err)
+			}
+			continue
+		}
+		if !c.Success {
+			t.Errorf("%d: should have failed", i)
+			continue
+		}
+		if !reflect.DeepEqual(tr.Attrs, c.Output) {
+			t.Errorf("%d: got %+v and should be %+v", i, tr.Attrs, c.Output)
+		}
+	}
+
+	ev, err := ProcessEvent([]string{"ev", "foo", "bar", "2020-01-01", "1", "0,0,0", "10", "cur=GBP"})
+	if err != nil {
+		t.Fatalf("event failed %s", err)
+	}
+	if ev.Currency != "GBP" {
+		t.Errorf("event currency is %s and should be GBP", ev.Currency)
+	}
+}
+
+func TestTransactionRecord(t *testing.T) {
+	trs := []Transaction{
+		{0, "foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), amount("-10.5"), Attrs{}},
+		{0, "bar baz", "a \"quoted\" one", time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC), amount("7"), Attrs{"USD", "cash", "food", []string{"a", "b"}, "2020-1"}},
+	}
+
+	for i, tr := range trs {
+		got, err := ProcessTransaction(TransactionRecord(tr))
+		if err != nil {
+			t.Errorf("%d: failed %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tr) {
+			t.Errorf("%d: got %+v and should be %+v", i, got, tr)
+		}
+	}
+}
+
+func TestEventRecord(t *testing.T) {
+	evs := []Event{
+		{0, "foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 1, [3]int{0, 0, 0}, amount("-10.5"), Attrs{}, Active},
+		{0, "bar baz", "monthly", time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC), 12, [3]int{0, 1, 0}, amount("7"), Attrs{"USD", "cash", "food", []string{"a", "b"}, ""}, Active},
+	}
+
+	for i, ev := range evs {
+		got, err := ProcessEvent(EventRecord(ev))
+		if err != nil {
+			t.Errorf("%d: failed %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, ev) {
+			t.Errorf("%d: got %+v and should be %+v", i, got, ev)
+		}
+	}
+}
+
+func TestBuildStatsCategories(t *testing.T) {
+	now := time.Now()
+
+	trs := []Transaction{
+		{0, "market", "", now, amount("-30"), Attrs{Category: "groceries"}},
+		{1, "baker", "", now, amount("-5.5"), Attrs{Category: "groceries", Tags: []string{"bread"}}},
+		{2, "power", "", now, amount("-60"), Attrs{Category: "utilities"}},
+		{3, "misc", "", now, amount("-1"), Attrs{}},
+	}
+	evs := []Event{
+		{0, "salary", "", now, 1, [3]int{0, 0, 0}, amount("1000"), Attrs{Category: "work"}, Active},
+		{1, "rent", "", now, 1, [3]int{0, 0, 0}, amount("-500"), Attrs{Category: "housing"}, Active},
+		{2, "water", "", now, 1, [3]int{0, 0, 0}, amount("-20"), Attrs{Category: "utilities"}, Active},
+	}
+
+	s := BuildStats(trs, nil, evs, nil, nil, Settings{Clock: NewVirtualClock(now)})
+
+	checkCategories := func(name string, got, expected map[string]Amount) {
+		if len(got) != len(expected) {
+			t.Errorf("%s: got %d categories and should be %d", name, len(got), len(expected))
+		}
+		for cat, a := range expected {
+			if got[cat] != a {
+				t.Errorf("%s: %s is %s and should be %s", name, cat, got[cat], a)
+			}
+		}
+	}
+
+	checkCategories("treasury", s.Treasury.Categories, map[string]Amount{
+		"groceries": amount("-35.5"),
+		"utilities": amount("-60"),
+	})
+	checkCategories("income", s.Income.Categories, map[string]Amount{
+		"work": amount("1000"),
+	})
+	checkCategories("expenses", s.Expenses.Categories, map[string]Amount{
+		"housing":   amount("-500"),
+		"utilities": amount("-20"),
+	})
+
+	if tags := s.Treasury.Entries[1].Tags; len(tags) != 1 || tags[0] != "bread" {
+		t.Errorf("tags are %v and should be [bread]", tags)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	now := time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	ev := Event{0, "foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 5, [3]int{0, 1, 0}, 1, Attrs{}, Paused}
+	Skip(&ev, now)
+	if !ev.Date.Equal(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date is %s and should be 2020-05-01", ev.Date)
+	}
+	if ev.Times != 5 {
+		t.Errorf("times is %d and should be 5", ev.Times)
+	}
+
+	// a single occurrence is dropped
+	ev = Event{0, "foo", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 1, [3]int{0, 0, 0}, 1, Attrs{}, Paused}
+	Skip(&ev, now)
+	if ev.Times != 0 {
+		t.Errorf("times is %d and should be 0", ev.Times)
+	}
+
+	// future events stay where they are
+	future := now.AddDate(0, 0, 1)
+	ev = Event{0, "foo", "", future, 1, [3]int{0, 0, 0}, 1, Attrs{}, Paused}
+	Skip(&ev, now)
+	if ev.Times != 1 || !ev.Date.Equal(future) {
+		t.Errorf("future event changed: %+v", ev)
+	}
+}
+
+func TestEventState(t *testing.T) {
+	now := time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, state := range []EventState{Paused, Cancelled} {
+		ev := event("ev", "foo", "", "2020-01-01", "-1", "0,1,0", "1")
+		ev.State = state
+		if dates := Missed(ev, now); len(dates) != 0 {
+			t.Errorf("%s event missed %d occurrences", state, len(dates))
+		}
+
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatalf("%s: marshal failed %s", state, err)
+		}
+		if !strings.Contains(string(b), `"State":"`+state.String()+`"`) {
+			t.Errorf("%s: state missing from %s", state, b)
+		}
+
+		var back Event
+		if err = json.Unmarshal(b, &back); err != nil {
+			t.Fatalf("%s: unmarshal failed %s", state, err)
+		}
+		if back.State != state {
+			t.Errorf("got %s back and should be %s", back.State, state)
+		}
+	}
+
+	// stopped events don't count in the month
+	evs := []Event{
+		{0, "foo", "", now, 1, [3]int{0, 0, 0}, amount("10"), Attrs{}, Active},
+		{1, "bar", "", now, 1, [3]int{0, 0, 0}, amount("20"), Attrs{}, Paused},
+		{2, "baz", "", now, 1, [3]int{0, 0, 0}, amount("40"), Attrs{}, Cancelled},
+	}
+	s := BuildStats(nil, nil, evs, nil, nil, Settings{Clock: NewVirtualClock(now)})
+	if s.Income.Total != amount("10") {
+		t.Errorf("income is %s and should be 10", s.Income.Total)
+	}
+	if len(s.Events) != 3 {
+		t.Errorf("got %d events in the stats and should be 3", len(s.Events))
+	}
+}